@@ -0,0 +1,383 @@
+// Copyright (C) 2022 OpenRFSense
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Affero General Public License as
+// published by the Free Software Foundation, either version 3 of the
+// License, or (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU Affero General Public License for more details.
+//
+// You should have received a copy of the GNU Affero General Public License
+// along with this program.  If not, see <http://www.gnu.org/licenses/>.
+
+package codec
+
+import (
+	"bytes"
+	"encoding/base64"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math"
+	"math/big"
+	"sort"
+	"strconv"
+	"unicode/utf8"
+)
+
+// CBOR major types.
+const (
+	majorUint   = 0
+	majorNegint = 1
+	majorBytes  = 2
+	majorText   = 3
+	majorArray  = 4
+	majorMap    = 5
+	majorTag    = 6
+	majorSimple = 7
+)
+
+// Maximum nesting of arrays and maps accepted when decoding.
+const maxDepth = 512
+
+// Returned when decoding malformed or unsupported CBOR data.
+var ErrInvalidCBOR = errors.New("invalid CBOR data")
+
+// Encodes v as CBOR. v is first encoded as JSON, which is then translated to the
+// equivalent CBOR data item. Map keys are sorted.
+func MarshalCBOR(v interface{}) ([]byte, error) {
+	raw, err := json.Marshal(v)
+	if err != nil {
+		return nil, err
+	}
+
+	dec := json.NewDecoder(bytes.NewReader(raw))
+	dec.UseNumber()
+	var generic interface{}
+	if err := dec.Decode(&generic); err != nil {
+		return nil, err
+	}
+
+	return appendItem(nil, generic)
+}
+
+// Decodes CBOR data, as produced by MarshalCBOR, into v. The data item is
+// translated to JSON and decoded with encoding/json, so v is filled exactly as
+// if the JSON form had been received. Byte strings become base64 strings, as
+// encoding/json does for []byte.
+func UnmarshalCBOR(data []byte, v interface{}) error {
+	d := decoder{data: data}
+	item, err := d.item(0)
+	if err != nil {
+		return err
+	}
+	if d.pos != len(d.data) {
+		return fmt.Errorf("%w: %d trailing bytes", ErrInvalidCBOR, len(d.data)-d.pos)
+	}
+
+	raw, err := json.Marshal(item)
+	if err != nil {
+		return err
+	}
+	return json.Unmarshal(raw, v)
+}
+
+// Appends the head of a data item: major type and argument.
+func appendHead(buf []byte, major byte, n uint64) []byte {
+	m := major << 5
+	switch {
+	case n < 24:
+		return append(buf, m|byte(n))
+	case n <= math.MaxUint8:
+		return append(buf, m|24, byte(n))
+	case n <= math.MaxUint16:
+		return binary.BigEndian.AppendUint16(append(buf, m|25), uint16(n))
+	case n <= math.MaxUint32:
+		return binary.BigEndian.AppendUint32(append(buf, m|26), uint32(n))
+	default:
+		return binary.BigEndian.AppendUint64(append(buf, m|27), n)
+	}
+}
+
+// Appends a generic JSON value (as decoded with json.Decoder.UseNumber) as CBOR.
+func appendItem(buf []byte, v interface{}) ([]byte, error) {
+	switch v := v.(type) {
+	case nil:
+		return append(buf, majorSimple<<5|22), nil
+	case bool:
+		if v {
+			return append(buf, majorSimple<<5|21), nil
+		}
+		return append(buf, majorSimple<<5|20), nil
+	case string:
+		buf = appendHead(buf, majorText, uint64(len(v)))
+		return append(buf, v...), nil
+	case json.Number:
+		return appendNumber(buf, v)
+	case []interface{}:
+		buf = appendHead(buf, majorArray, uint64(len(v)))
+		var err error
+		for _, e := range v {
+			if buf, err = appendItem(buf, e); err != nil {
+				return nil, err
+			}
+		}
+		return buf, nil
+	case map[string]interface{}:
+		keys := make([]string, 0, len(v))
+		for k := range v {
+			keys = append(keys, k)
+		}
+		sort.Strings(keys)
+
+		buf = appendHead(buf, majorMap, uint64(len(v)))
+		var err error
+		for _, k := range keys {
+			buf = appendHead(buf, majorText, uint64(len(k)))
+			buf = append(buf, k...)
+			if buf, err = appendItem(buf, v[k]); err != nil {
+				return nil, err
+			}
+		}
+		return buf, nil
+	default:
+		return nil, fmt.Errorf("cbor: unexpected type %T", v)
+	}
+}
+
+// Appends a JSON number as a CBOR integer if it is one, otherwise as the
+// smallest float which represents it exactly. "-0" is a float, since CBOR
+// integers have no negative zero.
+func appendNumber(buf []byte, n json.Number) ([]byte, error) {
+	if u, err := strconv.ParseUint(string(n), 10, 64); err == nil {
+		return appendHead(buf, majorUint, u), nil
+	}
+	if i, err := strconv.ParseInt(string(n), 10, 64); err == nil && i < 0 {
+		return appendHead(buf, majorNegint, uint64(-1-i)), nil
+	}
+
+	f, err := n.Float64()
+	if err != nil {
+		return nil, err
+	}
+	if f32 := float32(f); float64(f32) == f {
+		return binary.BigEndian.AppendUint32(append(buf, majorSimple<<5|26), math.Float32bits(f32)), nil
+	}
+	return binary.BigEndian.AppendUint64(append(buf, majorSimple<<5|27), math.Float64bits(f)), nil
+}
+
+// Type decoder reads CBOR data items into generic JSON values.
+type decoder struct {
+	data []byte
+	pos  int
+}
+
+// Reads n bytes.
+func (d *decoder) read(n uint64) ([]byte, error) {
+	if n > uint64(len(d.data)-d.pos) {
+		return nil, fmt.Errorf("%w: unexpected end of data", ErrInvalidCBOR)
+	}
+	b := d.data[d.pos : d.pos+int(n)]
+	d.pos += int(n)
+	return b, nil
+}
+
+// Reads the head of a data item. indefinite is true for the indefinite length
+// marker (additional information 31).
+func (d *decoder) head() (major byte, info byte, n uint64, indefinite bool, err error) {
+	b, err := d.read(1)
+	if err != nil {
+		return 0, 0, 0, false, err
+	}
+	major, info = b[0]>>5, b[0]&0x1f
+
+	switch {
+	case info < 24:
+		return major, info, uint64(info), false, nil
+	case info == 31:
+		return major, info, 0, true, nil
+	case info > 27:
+		return 0, 0, 0, false, fmt.Errorf("%w: reserved additional information %d", ErrInvalidCBOR, info)
+	}
+
+	arg, err := d.read(1 << (info - 24))
+	if err != nil {
+		return 0, 0, 0, false, err
+	}
+	switch len(arg) {
+	case 1:
+		n = uint64(arg[0])
+	case 2:
+		n = uint64(binary.BigEndian.Uint16(arg))
+	case 4:
+		n = uint64(binary.BigEndian.Uint32(arg))
+	default:
+		n = binary.BigEndian.Uint64(arg)
+	}
+	return major, info, n, false, nil
+}
+
+// Returns true and consumes it if the next byte is the "break" stop code.
+func (d *decoder) isBreak() bool {
+	if d.pos < len(d.data) && d.data[d.pos] == 0xff {
+		d.pos++
+		return true
+	}
+	return false
+}
+
+// Reads a single data item.
+func (d *decoder) item(depth int) (interface{}, error) {
+	if depth > maxDepth {
+		return nil, fmt.Errorf("%w: nesting too deep", ErrInvalidCBOR)
+	}
+
+	major, info, n, indefinite, err := d.head()
+	if err != nil {
+		return nil, err
+	}
+	if indefinite && (major == majorUint || major == majorNegint || major == majorTag) {
+		return nil, fmt.Errorf("%w: indefinite length for major type %d", ErrInvalidCBOR, major)
+	}
+
+	switch major {
+	case majorUint:
+		return json.Number(strconv.FormatUint(n, 10)), nil
+	case majorNegint:
+		if n > math.MaxInt64 {
+			// -1-n does not fit an int64, but is still a valid JSON number
+			v := new(big.Int).SetUint64(n)
+			return json.Number(v.Neg(v.Add(v, big.NewInt(1))).String()), nil
+		}
+		return json.Number(strconv.FormatInt(-1-int64(n), 10)), nil
+	case majorBytes, majorText:
+		s, err := d.stringItem(major, n, indefinite)
+		if err != nil {
+			return nil, err
+		}
+		if major == majorBytes {
+			return base64.StdEncoding.EncodeToString(s), nil
+		}
+		if !utf8.Valid(s) {
+			return nil, fmt.Errorf("%w: invalid UTF-8 in text string", ErrInvalidCBOR)
+		}
+		return string(s), nil
+	case majorArray:
+		ret := []interface{}{}
+		for i := uint64(0); indefinite || i < n; i++ {
+			if indefinite && d.isBreak() {
+				break
+			}
+			e, err := d.item(depth + 1)
+			if err != nil {
+				return nil, err
+			}
+			ret = append(ret, e)
+		}
+		return ret, nil
+	case majorMap:
+		ret := map[string]interface{}{}
+		for i := uint64(0); indefinite || i < n; i++ {
+			if indefinite && d.isBreak() {
+				break
+			}
+			k, err := d.item(depth + 1)
+			if err != nil {
+				return nil, err
+			}
+			key, ok := k.(string)
+			if !ok {
+				return nil, fmt.Errorf("%w: map keys must be text strings", ErrInvalidCBOR)
+			}
+			if ret[key], err = d.item(depth + 1); err != nil {
+				return nil, err
+			}
+		}
+		return ret, nil
+	case majorTag:
+		// Tags carry no meaning in the JSON form, decode the tagged item only
+		return d.item(depth + 1)
+	default:
+		return d.simple(info, n)
+	}
+}
+
+// Reads the content of a byte or text string, concatenating indefinite chunks.
+func (d *decoder) stringItem(major byte, n uint64, indefinite bool) ([]byte, error) {
+	if !indefinite {
+		return d.read(n)
+	}
+
+	ret := []byte{}
+	for !d.isBreak() {
+		chunkMajor, _, chunkLen, chunkIndefinite, err := d.head()
+		if err != nil {
+			return nil, err
+		}
+		if chunkMajor != major || chunkIndefinite {
+			return nil, fmt.Errorf("%w: invalid string chunk", ErrInvalidCBOR)
+		}
+		chunk, err := d.read(chunkLen)
+		if err != nil {
+			return nil, err
+		}
+		ret = append(ret, chunk...)
+	}
+	return ret, nil
+}
+
+// Decodes a major type 7 item: booleans, null and floats.
+func (d *decoder) simple(info byte, n uint64) (interface{}, error) {
+	var f float64
+	switch info {
+	case 20:
+		return false, nil
+	case 21:
+		return true, nil
+	case 22, 23:
+		// null and undefined
+		return nil, nil
+	case 25:
+		f = halfToFloat(uint16(n))
+	case 26:
+		f = float64(math.Float32frombits(uint32(n)))
+	case 27:
+		f = math.Float64frombits(n)
+	default:
+		return nil, fmt.Errorf("%w: unsupported simple value %d", ErrInvalidCBOR, n)
+	}
+
+	if math.IsNaN(f) || math.IsInf(f, 0) {
+		return nil, fmt.Errorf("%w: %v cannot be represented in JSON", ErrInvalidCBOR, f)
+	}
+	return f, nil
+}
+
+// Converts an IEEE 754 half-precision float to float64.
+func halfToFloat(h uint16) float64 {
+	exp := int(h>>10) & 0x1f
+	mant := float64(h & 0x3ff)
+
+	var f float64
+	switch exp {
+	case 0:
+		f = math.Ldexp(mant, -24)
+	case 31:
+		if mant == 0 {
+			f = math.Inf(1)
+		} else {
+			f = math.NaN()
+		}
+	default:
+		f = math.Ldexp(mant+1024, exp-25)
+	}
+
+	if h&0x8000 != 0 {
+		return -f
+	}
+	return f
+}
@@ -0,0 +1,87 @@
+// Copyright (C) 2022 OpenRFSense
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Affero General Public License as
+// published by the Free Software Foundation, either version 3 of the
+// License, or (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU Affero General Public License for more details.
+//
+// You should have received a copy of the GNU Affero General Public License
+// along with this program.  If not, see <http://www.gnu.org/licenses/>.
+
+// Package codec encodes the types shared between nodes and backend (such as
+// stats.Stats and the measurement requests in package types) either as JSON or,
+// for constrained uplinks, as CBOR (RFC 8949). The CBOR form is built from the
+// JSON one, so both always carry the same data and custom JSON methods apply.
+package codec
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"mime"
+	"strings"
+)
+
+// Supported content types.
+const (
+	ContentTypeJSON = "application/json"
+	ContentTypeCBOR = "application/cbor"
+)
+
+// Returned when encoding or decoding with an unknown content type.
+var ErrUnsupportedContentType = errors.New("unsupported content type")
+
+// Encodes v in the format identified by contentType. Media type parameters
+// (such as "; charset=utf-8") are ignored.
+func Marshal(contentType string, v interface{}) ([]byte, error) {
+	switch mediaType(contentType) {
+	case ContentTypeJSON:
+		return json.Marshal(v)
+	case ContentTypeCBOR:
+		return MarshalCBOR(v)
+	default:
+		return nil, fmt.Errorf("%w: %s", ErrUnsupportedContentType, contentType)
+	}
+}
+
+// Decodes data in the format identified by contentType into v. Media type
+// parameters (such as "; charset=utf-8") are ignored.
+func Unmarshal(contentType string, data []byte, v interface{}) error {
+	switch mediaType(contentType) {
+	case ContentTypeJSON:
+		return json.Unmarshal(data, v)
+	case ContentTypeCBOR:
+		return UnmarshalCBOR(data, v)
+	default:
+		return fmt.Errorf("%w: %s", ErrUnsupportedContentType, contentType)
+	}
+}
+
+// Returns the preferred supported content type listed in an HTTP Accept header.
+// Defaults to JSON if none is listed. Quality values are not taken into account,
+// the first supported type wins.
+func Negotiate(accept string) string {
+	for _, part := range strings.Split(accept, ",") {
+		switch mediaType(part) {
+		case ContentTypeCBOR:
+			return ContentTypeCBOR
+		case ContentTypeJSON:
+			return ContentTypeJSON
+		}
+	}
+	return ContentTypeJSON
+}
+
+// Returns the lowercase media type of a content type, without parameters.
+func mediaType(contentType string) string {
+	mt, _, err := mime.ParseMediaType(contentType)
+	if err != nil {
+		return strings.ToLower(strings.TrimSpace(contentType))
+	}
+	return mt
+}
@@ -0,0 +1,238 @@
+// Copyright (C) 2022 OpenRFSense
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Affero General Public License as
+// published by the Free Software Foundation, either version 3 of the
+// License, or (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU Affero General Public License for more details.
+//
+// You should have received a copy of the GNU Affero General Public License
+// along with this program.  If not, see <http://www.gnu.org/licenses/>.
+
+package codec
+
+import (
+	"bytes"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"math"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/openrfsense/common/stats"
+	"github.com/openrfsense/common/stats/providers"
+	"github.com/openrfsense/common/types"
+)
+
+// Encodes v as both JSON and CBOR, decodes the CBOR form into out and checks that
+// its JSON encoding matches the original one.
+func testRoundTrip(t *testing.T, v interface{}, out interface{}) {
+	t.Helper()
+
+	expJSON, err := Marshal(ContentTypeJSON, v)
+	if err != nil {
+		t.Fatal(err)
+	}
+	raw, err := Marshal(ContentTypeCBOR+"; charset=binary", v)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(raw) >= len(expJSON) {
+		t.Errorf("expected CBOR (%d bytes) to be smaller than JSON (%d bytes)", len(raw), len(expJSON))
+	}
+
+	err = Unmarshal(ContentTypeCBOR, raw, out)
+	if err != nil {
+		t.Fatal(err)
+	}
+	gotJSON, err := json.Marshal(out)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var exp, got interface{}
+	_ = json.Unmarshal(expJSON, &exp)
+	_ = json.Unmarshal(gotJSON, &got)
+	if !reflect.DeepEqual(exp, got) {
+		t.Fatalf("expected JSON form '%s', got '%s'", expJSON, gotJSON)
+	}
+}
+
+func TestRoundTrip(t *testing.T) {
+	t.Run("stats", func(t *testing.T) {
+		s := stats.Stats{
+			ID:       "abcdefghijklmnop",
+			Hostname: "node",
+			Model:    "Raspberry Pi 4 Model B Rev 1.4",
+			Uptime:   26*time.Hour + 500*time.Millisecond,
+			BootTime: time.Date(2022, 6, 1, 12, 0, 0, 0, time.UTC),
+			Providers: map[string]interface{}{
+				"load": providers.LoadStats{Load1: 0.52, Load5: 0.58, Load15: 0.59, Running: 2, Total: 312},
+				"memory": providers.MemoryStats{
+					Total:     3977601024,
+					SwapTotal: 18446744073709551615,
+				},
+				"custom": map[string]interface{}{"negative": -42, "list": []interface{}{true, nil, "x"}},
+			},
+			Errors: map[string]string{"sdr": "device busy"},
+		}
+
+		out := stats.Stats{}
+		testRoundTrip(t, s, &out)
+
+		if _, ok := out.Providers["load"].(providers.LoadStats); !ok {
+			t.Fatalf("expected registered provider types to be decoded, got %T", out.Providers["load"])
+		}
+		if out.Providers["memory"].(providers.MemoryStats).SwapTotal != 18446744073709551615 {
+			t.Fatal("expected uint64 values to be kept exactly")
+		}
+		if out.Uptime != s.Uptime {
+			t.Fatalf("expected uptime %v, got %v", s.Uptime, out.Uptime)
+		}
+	})
+
+	t.Run("aggregated measurement request", func(t *testing.T) {
+		now := time.Date(2022, 6, 1, 12, 0, 0, 0, time.UTC)
+		amr := types.AggregatedMeasurementRequest{
+			Sensors:    []string{"abcdefghijklmnop", "qrstuvwxyzabcdef"},
+			Begin:      now,
+			End:        now.Add(time.Hour),
+			FreqMin:    10e8,
+			FreqMax:    16e8,
+			FreqRes:    100000,
+			TimeRes:    30,
+			CampaignId: "campaign",
+		}
+
+		out := types.AggregatedMeasurementRequest{}
+		testRoundTrip(t, amr, &out)
+		if !reflect.DeepEqual(amr, out) {
+			t.Fatalf("expected %+v, got %+v", amr, out)
+		}
+	})
+
+	t.Run("raw measurement request", func(t *testing.T) {
+		now := time.Date(2022, 6, 1, 12, 0, 0, 0, time.UTC)
+		rmr := types.RawMeasurementRequest{
+			Sensors:    []string{"abcdefghijklmnop"},
+			FreqCenter: 43392e4,
+			Begin:      now,
+			End:        now.Add(time.Minute),
+		}
+
+		out := types.RawMeasurementRequest{}
+		testRoundTrip(t, rmr, &out)
+		if !reflect.DeepEqual(rmr, out) {
+			t.Fatalf("expected %+v, got %+v", rmr, out)
+		}
+	})
+}
+
+func TestCBOR(t *testing.T) {
+	t.Run("encoding", func(t *testing.T) {
+		tests := map[string]interface{}{
+			"00":                 0,
+			"1a000f4240":         1000000,
+			"20":                 -1,
+			"3903e7":             -1000,
+			"fa3fc00000":         1.5,
+			"fa80000000":         math.Copysign(0, -1),
+			"fb3ff199999999999a": 1.1,
+			"f4":                 false,
+			"f6":                 nil,
+			"6161":               "a",
+			"83010203":           []int{1, 2, 3},
+			"a2616101616282f5f4": map[string]interface{}{"b": []bool{true, false}, "a": 1},
+		}
+		for exp, v := range tests {
+			raw, err := MarshalCBOR(v)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got := hex.EncodeToString(raw); got != exp {
+				t.Errorf("expected %v to be encoded as %s, got %s", v, exp, got)
+			}
+		}
+	})
+
+	t.Run("decoding", func(t *testing.T) {
+		// Examples from RFC 8949, Appendix A
+		tests := map[string]string{
+			"1903e8":                     `1000`,
+			"3bffffffffffffffff":         `-18446744073709551616`,
+			"f93c00":                     `1`,
+			"f9c400":                     `-4`,
+			"f90001":                     `5.960464477539063e-8`,
+			"c11a514b67b0":               `1363896240`,
+			"4401020304":                 `"AQIDBA=="`,
+			"7f657374726561646d696e67ff": `"streaming"`,
+			"9f018202039f0405ffff":       `[1,[2,3],[4,5]]`,
+			"bf61610161629f0203ffff":     `{"a":1,"b":[2,3]}`,
+			"a56161614161626142616361436164614461656145": `{"a":"A","b":"B","c":"C","d":"D","e":"E"}`,
+		}
+		for in, exp := range tests {
+			raw, _ := hex.DecodeString(in)
+			var got json.RawMessage
+			err := UnmarshalCBOR(raw, &got)
+			if err != nil {
+				t.Errorf("decoding %s: %v", in, err)
+				continue
+			}
+			if !bytes.Equal(got, []byte(exp)) {
+				t.Errorf("expected %s to be decoded as %s, got %s", in, exp, got)
+			}
+		}
+	})
+
+	t.Run("negative zero", func(t *testing.T) {
+		raw, err := MarshalCBOR(map[string]interface{}{"g": math.Copysign(0, -1)})
+		if err != nil {
+			t.Fatal(err)
+		}
+		got := map[string]float64{}
+		if err := UnmarshalCBOR(raw, &got); err != nil {
+			t.Fatal(err)
+		}
+		if g := got["g"]; g != 0 || !math.Signbit(g) {
+			t.Fatalf("expected -0, got %v", g)
+		}
+	})
+
+	t.Run("invalid data", func(t *testing.T) {
+		for _, in := range []string{"", "1a0000", "a10102", "62ff", "f97c00", "0000", "5bffffffffffffffff", "1c"} {
+			raw, _ := hex.DecodeString(in)
+			var got interface{}
+			if err := UnmarshalCBOR(raw, &got); !errors.Is(err, ErrInvalidCBOR) {
+				t.Errorf("expected %s to be invalid, got %v", in, err)
+			}
+		}
+	})
+
+	t.Run("unsupported content type", func(t *testing.T) {
+		_, err := Marshal("application/xml", 1)
+		if !errors.Is(err, ErrUnsupportedContentType) {
+			t.Fatalf("expected ErrUnsupportedContentType, got %v", err)
+		}
+	})
+}
+
+func TestNegotiate(t *testing.T) {
+	tests := map[string]string{
+		"":                                   ContentTypeJSON,
+		"*/*":                                ContentTypeJSON,
+		"application/cbor":                   ContentTypeCBOR,
+		"text/html, application/cbor;q=0.9":  ContentTypeCBOR,
+		"application/json, application/cbor": ContentTypeJSON,
+	}
+	for accept, exp := range tests {
+		if got := Negotiate(accept); got != exp {
+			t.Errorf("expected '%s' for Accept '%s', got '%s'", exp, accept, got)
+		}
+	}
+}
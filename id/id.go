@@ -25,6 +25,14 @@ func GenerateFromBytes(seed []byte, length int) string {
 	return generateWithSource(src, length)
 }
 
+// Generates an arbitrarily long random string using seed as the seed of the
+// generator. The same seed always gives the same string.
+func GenerateFromSeed(seed int64, length int) string {
+	src := rand.NewSource(seed)
+
+	return generateWithSource(src, length)
+}
+
 // Generates a random string given its length and a generator function returning
 // a number (int64) on call.
 func generateWithSource(src rand.Source, length int) string {
@@ -0,0 +1,30 @@
+package id
+
+import "testing"
+
+func TestGenerateFromSeed(t *testing.T) {
+	t.Run("determinism", func(t *testing.T) {
+		for _, seed := range []int64{0, 1, -1, 1 << 62} {
+			if a, b := GenerateFromSeed(seed, 16), GenerateFromSeed(seed, 16); a != b {
+				t.Fatalf("expected the same string for seed %d, got '%s' and '%s'", seed, a, b)
+			}
+		}
+		if a, b := GenerateFromSeed(1, 16), GenerateFromSeed(2, 16); a == b {
+			t.Fatalf("expected different strings for different seeds, got '%s' for both", a)
+		}
+	})
+
+	t.Run("length", func(t *testing.T) {
+		for _, length := range []int{0, 1, 10, 16, 100} {
+			got := GenerateFromSeed(42, length)
+			if len(got) != length {
+				t.Fatalf("expected length %d, got %d ('%s')", length, len(got), got)
+			}
+			for _, r := range got {
+				if r < 'a' || r > 'z' {
+					t.Fatalf("expected only lowercase letters, got '%s'", got)
+				}
+			}
+		}
+	})
+}
@@ -20,60 +20,90 @@ var logger = New()
 
 // Debug uses fmt.Sprint to construct and log a message at DebugLevel.
 func Debug(args ...interface{}) {
-	logger.do(DebugLevel, "", args...)
+	logger.print(DebugLevel, args...)
 }
 
 // Info uses fmt.Sprint to construct and log a message at InfoLevel.
 func Info(args ...interface{}) {
-	logger.do(InfoLevel, "", args...)
+	logger.print(InfoLevel, args...)
 }
 
 // Warn uses fmt.Sprint to construct and log a message at WarnLevel.
 func Warn(args ...interface{}) {
-	logger.do(WarnLevel, "", args...)
+	logger.print(WarnLevel, args...)
 }
 
 // Error uses fmt.Sprint to construct and log a message at ErrorLevel.
 func Error(args ...interface{}) {
-	logger.do(ErrorLevel, "", args...)
+	logger.print(ErrorLevel, args...)
 }
 
 // Panic uses fmt.Sprint to construct and log a message at PanicLevel, then panics.
 func Panic(args ...interface{}) {
-	logger.do(PanicLevel, "", args...)
+	logger.print(PanicLevel, args...)
 }
 
 // Fatal uses fmt.Sprint to construct and log a message at FatalLevel, then calls os.Exit.
 func Fatal(args ...interface{}) {
-	logger.do(FatalLevel, "", args...)
+	logger.print(FatalLevel, args...)
 }
 
 // Debugf uses fmt.Sprintf to log a formatted message at DebugLevel.
 func Debugf(template string, args ...interface{}) {
-	logger.do(DebugLevel, template, args...)
+	logger.printf(DebugLevel, template, args...)
 }
 
 // Infof uses fmt.Sprintf log a formatted message at InfoLevel.
 func Infof(template string, args ...interface{}) {
-	logger.do(InfoLevel, template, args...)
+	logger.printf(InfoLevel, template, args...)
 }
 
 // Warnf uses fmt.Sprintf log a formatted message at WarnLevel.
 func Warnf(template string, args ...interface{}) {
-	logger.do(WarnLevel, template, args...)
+	logger.printf(WarnLevel, template, args...)
 }
 
 // Errorf uses fmt.Sprintf log a formatted message at ErrorLevel.
 func Errorf(template string, args ...interface{}) {
-	logger.do(ErrorLevel, template, args...)
+	logger.printf(ErrorLevel, template, args...)
 }
 
 // Panicf uses fmt.Sprintf log a formatted message at PanicLevel, then panics.
 func Panicf(template string, args ...interface{}) {
-	logger.do(PanicLevel, template, args...)
+	logger.printf(PanicLevel, template, args...)
 }
 
 // Fatalf uses fmt.Sprintf log a formatted message at FatalLevel, then calls os.Exit.
 func Fatalf(template string, args ...interface{}) {
-	logger.do(FatalLevel, template, args...)
+	logger.printf(FatalLevel, template, args...)
+}
+
+// DebugFields logs a message with typed fields at DebugLevel.
+func DebugFields(msg string, fields ...Field) {
+	logger.log(DebugLevel, msg, fields)
+}
+
+// InfoFields logs a message with typed fields at InfoLevel.
+func InfoFields(msg string, fields ...Field) {
+	logger.log(InfoLevel, msg, fields)
+}
+
+// WarnFields logs a message with typed fields at WarnLevel.
+func WarnFields(msg string, fields ...Field) {
+	logger.log(WarnLevel, msg, fields)
+}
+
+// ErrorFields logs a message with typed fields at ErrorLevel.
+func ErrorFields(msg string, fields ...Field) {
+	logger.log(ErrorLevel, msg, fields)
+}
+
+// PanicFields logs a message with typed fields at PanicLevel, then panics.
+func PanicFields(msg string, fields ...Field) {
+	logger.log(PanicLevel, msg, fields)
+}
+
+// FatalFields logs a message with typed fields at FatalLevel, then calls os.Exit.
+func FatalFields(msg string, fields ...Field) {
+	logger.log(FatalLevel, msg, fields)
 }
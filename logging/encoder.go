@@ -0,0 +1,113 @@
+// Copyright (C) 2022 OpenRFSense
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Affero General Public License as
+// published by the Free Software Foundation, either version 3 of the
+// License, or (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU Affero General Public License for more details.
+//
+// You should have received a copy of the GNU Affero General Public License
+// along with this program.  If not, see <http://www.gnu.org/licenses/>.
+
+package logging
+
+import (
+	"math"
+	"strconv"
+	"sync"
+	"unicode/utf8"
+)
+
+// Pool of scratch buffers used to encode a single log line. A pointer to the
+// slice is stored so that Get/Put do not allocate themselves.
+var bufferPool = sync.Pool{
+	New: func() interface{} {
+		buf := make([]byte, 0, 256)
+		return &buf
+	},
+}
+
+// Buffers which grew larger than this are not returned to the pool, so a single
+// huge message does not pin memory forever.
+const maxPooledBuffer = 64 << 10
+
+func getBuffer() *[]byte {
+	buf := bufferPool.Get().(*[]byte)
+	*buf = (*buf)[:0]
+	return buf
+}
+
+func putBuffer(buf *[]byte) {
+	if cap(*buf) > maxPooledBuffer {
+		return
+	}
+	bufferPool.Put(buf)
+}
+
+// Appends the fields to buf as space-separated key=value pairs. Values of fields
+// hidden by the redaction rules are replaced with Redacted.
+func appendFields(buf []byte, fields []Field, r *redaction) []byte {
+	for i := range fields {
+		f := &fields[i]
+		buf = append(buf, ' ')
+		buf = append(buf, f.Key...)
+		buf = append(buf, '=')
+		if r.hidesKey(f.Key) {
+			buf = append(buf, Redacted...)
+			continue
+		}
+		buf = appendValue(buf, f)
+	}
+	return buf
+}
+
+// Appends the textual representation of a single field value to buf.
+func appendValue(buf []byte, f *Field) []byte {
+	switch f.typ {
+	case stringType:
+		return appendString(buf, f.str)
+	case int64Type:
+		return strconv.AppendInt(buf, f.num, 10)
+	case float64Type:
+		return strconv.AppendFloat(buf, math.Float64frombits(uint64(f.num)), 'g', -1, 64)
+	case durationType:
+		// Seconds with a unit suffix, which time.ParseDuration reads back. Avoids
+		// the allocation done by time.Duration.String.
+		buf = strconv.AppendFloat(buf, float64(f.num)/1e9, 'f', -1, 64)
+		return append(buf, 's')
+	case errorType:
+		if f.err == nil {
+			return append(buf, "<nil>"...)
+		}
+		return appendString(buf, f.err.Error())
+	default:
+		return append(buf, "<unknown>"...)
+	}
+}
+
+// Appends s to buf, quoting it only if it would otherwise be ambiguous.
+func appendString(buf []byte, s string) []byte {
+	if needsQuoting(s) {
+		return strconv.AppendQuote(buf, s)
+	}
+	return append(buf, s...)
+}
+
+// Returns true if s is empty or contains whitespace, quotes, '=' or anything
+// that is not printable ASCII.
+func needsQuoting(s string) bool {
+	if s == "" {
+		return true
+	}
+	for i := 0; i < len(s); i++ {
+		c := s[i]
+		if c >= utf8.RuneSelf || c <= ' ' || c == '=' || c == '"' || c == 0x7f {
+			return true
+		}
+	}
+	return false
+}
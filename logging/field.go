@@ -0,0 +1,69 @@
+// Copyright (C) 2022 OpenRFSense
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Affero General Public License as
+// published by the Free Software Foundation, either version 3 of the
+// License, or (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU Affero General Public License for more details.
+//
+// You should have received a copy of the GNU Affero General Public License
+// along with this program.  If not, see <http://www.gnu.org/licenses/>.
+
+package logging
+
+import (
+	"math"
+	"time"
+)
+
+// A fieldType tells the encoder which member of a Field holds its value.
+type fieldType uint8
+
+const (
+	stringType fieldType = iota + 1
+	int64Type
+	float64Type
+	durationType
+	errorType
+)
+
+// Type Field is a typed key/value pair attached to a log message. Fields are
+// meant to be built with the constructors below (String, Int64, etc.), which
+// never box their value into an interface and therefore never allocate.
+type Field struct {
+	Key string
+
+	typ fieldType
+	num int64
+	str string
+	err error
+}
+
+// String constructs a field carrying a string value.
+func String(key string, val string) Field {
+	return Field{Key: key, typ: stringType, str: val}
+}
+
+// Int64 constructs a field carrying an int64 value.
+func Int64(key string, val int64) Field {
+	return Field{Key: key, typ: int64Type, num: val}
+}
+
+// Float64 constructs a field carrying a float64 value.
+func Float64(key string, val float64) Field {
+	return Field{Key: key, typ: float64Type, num: int64(math.Float64bits(val))}
+}
+
+// Duration constructs a field carrying a time.Duration value.
+func Duration(key string, val time.Duration) Field {
+	return Field{Key: key, typ: durationType, num: int64(val)}
+}
+
+// Err constructs a field carrying an error under the "error" key.
+func Err(err error) Field {
+	return Field{Key: "error", typ: errorType, err: err}
+}
@@ -20,6 +20,7 @@ import (
 	"io"
 	"log"
 	"os"
+	"regexp"
 )
 
 // Type Flags represents logger flags (a wrapper around log.L* flags).
@@ -38,6 +39,7 @@ type Logger struct {
 	logger *log.Logger
 	lvl    Level
 	name   string
+	redact redaction
 }
 
 // Creates a new Logger with the given options. The default logger has FlagsProduction,
@@ -78,18 +80,75 @@ func (l *Logger) WithPrefix(prefix string) *Logger {
 	return l
 }
 
-// Does the logging and panic/Exit.
-func (l Logger) do(lvl Level, template string, args ...interface{}) {
-	if lvl < l.lvl {
+// Hides the values of fields with any of the given names (case-insensitive).
+// Applies to typed fields only, see WithRedactedPatterns for free-form messages.
+func (l *Logger) WithRedactedFields(keys ...string) *Logger {
+	l.redact.keys = append(l.redact.keys, keys...)
+	return l
+}
+
+// Hides any text matching the given patterns in the encoded log line, including
+// messages built with fmt. If a pattern has capturing groups, only the groups are
+// hidden: `token=(\S+)` turns "token=abc" into "token=[REDACTED]".
+func (l *Logger) WithRedactedPatterns(patterns ...*regexp.Regexp) *Logger {
+	l.redact.patterns = append(l.redact.patterns, patterns...)
+	return l
+}
+
+// Number of stack frames between the caller of a public logging method and the
+// call to log.Logger.Output, used to report the right file with log.Lshortfile.
+const callDepth = 4
+
+// Returns true if messages at the given level would be written by the logger.
+// Useful to skip building expensive arguments for disabled levels.
+func (l Logger) Enabled(lvl Level) bool {
+	return lvl >= l.lvl
+}
+
+// Logs a message built with fmt.Sprint.
+func (l Logger) print(lvl Level, args ...interface{}) {
+	if !l.Enabled(lvl) {
 		return
 	}
 
-	if template == "" {
-		l.logger.Print(args...)
-	} else {
-		l.logger.Printf(template, args...)
+	buf := getBuffer()
+	*buf = fmt.Append(*buf, args...)
+	l.write(lvl, buf)
+}
+
+// Logs a message built with fmt.Sprintf.
+func (l Logger) printf(lvl Level, template string, args ...interface{}) {
+	if !l.Enabled(lvl) {
+		return
+	}
+
+	buf := getBuffer()
+	*buf = fmt.Appendf(*buf, template, args...)
+	l.write(lvl, buf)
+}
+
+// Logs a message followed by typed fields. Does not allocate if the level is
+// disabled.
+func (l Logger) log(lvl Level, msg string, fields []Field) {
+	if !l.Enabled(lvl) {
+		return
 	}
 
+	buf := getBuffer()
+	*buf = append(*buf, msg...)
+	*buf = appendFields(*buf, fields, &l.redact)
+	l.write(lvl, buf)
+}
+
+// Applies redaction patterns, then does the actual writing and panic/Exit.
+// Releases buf.
+func (l Logger) write(lvl Level, buf *[]byte) {
+	if len(l.redact.patterns) > 0 {
+		*buf = l.redact.apply(*buf)
+	}
+	_ = l.logger.Output(callDepth, string(*buf))
+	putBuffer(buf)
+
 	// This is actually just as fast as using log.Panic and log.Fatal
 	switch lvl {
 	case PanicLevel:
@@ -101,60 +160,90 @@ func (l Logger) do(lvl Level, template string, args ...interface{}) {
 
 // Debug uses fmt.Sprint to construct and log a message at DebugLevel.
 func (l Logger) Debug(args ...interface{}) {
-	l.do(DebugLevel, "", args...)
+	l.print(DebugLevel, args...)
 }
 
 // Info uses fmt.Sprint to construct and log a message at InfoLevel.
 func (l Logger) Info(args ...interface{}) {
-	l.do(InfoLevel, "", args...)
+	l.print(InfoLevel, args...)
 }
 
 // Warn uses fmt.Sprint to construct and log a message at WarnLevel.
 func (l Logger) Warn(args ...interface{}) {
-	l.do(WarnLevel, "", args...)
+	l.print(WarnLevel, args...)
 }
 
 // Error uses fmt.Sprint to construct and log a message at ErrorLevel.
 func (l Logger) Error(args ...interface{}) {
-	l.do(ErrorLevel, "", args...)
+	l.print(ErrorLevel, args...)
 }
 
 // Panic uses fmt.Sprint to construct and log a message at PanicLevel, then panics.
 func (l Logger) Panic(args ...interface{}) {
-	l.do(PanicLevel, "", args...)
+	l.print(PanicLevel, args...)
 }
 
 // Fatal uses fmt.Sprint to construct and log a message at FatalLevel, then calls os.Exit.
 func (l Logger) Fatal(args ...interface{}) {
-	l.do(FatalLevel, "", args...)
+	l.print(FatalLevel, args...)
 }
 
 // Debugf uses fmt.Sprintf to log a formatted message at DebugLevel.
 func (l Logger) Debugf(template string, args ...interface{}) {
-	l.do(DebugLevel, template, args...)
+	l.printf(DebugLevel, template, args...)
 }
 
 // Infof uses fmt.Sprintf log a formatted message at InfoLevel.
 func (l Logger) Infof(template string, args ...interface{}) {
-	l.do(InfoLevel, template, args...)
+	l.printf(InfoLevel, template, args...)
 }
 
 // Warnf uses fmt.Sprintf log a formatted message at WarnLevel.
 func (l Logger) Warnf(template string, args ...interface{}) {
-	l.do(WarnLevel, template, args...)
+	l.printf(WarnLevel, template, args...)
 }
 
 // Errorf uses fmt.Sprintf log a formatted message at ErrorLevel.
 func (l Logger) Errorf(template string, args ...interface{}) {
-	l.do(ErrorLevel, template, args...)
+	l.printf(ErrorLevel, template, args...)
 }
 
 // Panicf uses fmt.Sprintf log a formatted message at PanicLevel, then panics.
 func (l Logger) Panicf(template string, args ...interface{}) {
-	l.do(PanicLevel, template, args...)
+	l.printf(PanicLevel, template, args...)
 }
 
 // Fatalf uses fmt.Sprintf log a formatted message at FatalLevel, then calls os.Exit.
 func (l Logger) Fatalf(template string, args ...interface{}) {
-	l.do(FatalLevel, template, args...)
+	l.printf(FatalLevel, template, args...)
+}
+
+// DebugFields logs a message with typed fields at DebugLevel.
+func (l Logger) DebugFields(msg string, fields ...Field) {
+	l.log(DebugLevel, msg, fields)
+}
+
+// InfoFields logs a message with typed fields at InfoLevel.
+func (l Logger) InfoFields(msg string, fields ...Field) {
+	l.log(InfoLevel, msg, fields)
+}
+
+// WarnFields logs a message with typed fields at WarnLevel.
+func (l Logger) WarnFields(msg string, fields ...Field) {
+	l.log(WarnLevel, msg, fields)
+}
+
+// ErrorFields logs a message with typed fields at ErrorLevel.
+func (l Logger) ErrorFields(msg string, fields ...Field) {
+	l.log(ErrorLevel, msg, fields)
+}
+
+// PanicFields logs a message with typed fields at PanicLevel, then panics.
+func (l Logger) PanicFields(msg string, fields ...Field) {
+	l.log(PanicLevel, msg, fields)
+}
+
+// FatalFields logs a message with typed fields at FatalLevel, then calls os.Exit.
+func (l Logger) FatalFields(msg string, fields ...Field) {
+	l.log(FatalLevel, msg, fields)
 }
@@ -0,0 +1,77 @@
+// Copyright (C) 2022 OpenRFSense
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Affero General Public License as
+// published by the Free Software Foundation, either version 3 of the
+// License, or (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU Affero General Public License for more details.
+//
+// You should have received a copy of the GNU Affero General Public License
+// along with this program.  If not, see <http://www.gnu.org/licenses/>.
+
+package logging
+
+import (
+	"regexp"
+	"strings"
+)
+
+// The placeholder written in place of redacted values.
+const Redacted = "[REDACTED]"
+
+// Type redaction holds the rules used by the encoder to hide secrets before a
+// log line is written.
+type redaction struct {
+	// Field names (case-insensitive) whose values are never written
+	keys []string
+
+	// Patterns matched against the whole encoded line
+	patterns []*regexp.Regexp
+}
+
+// Returns true if the value of the field with the given key must be hidden.
+func (r *redaction) hidesKey(key string) bool {
+	for _, k := range r.keys {
+		if strings.EqualFold(k, key) {
+			return true
+		}
+	}
+	return false
+}
+
+// Replaces every match of the registered patterns in line with Redacted. If a
+// pattern contains capturing groups, only the text matched by the groups is
+// replaced, so "token=(\S+)" keeps the "token=" part readable.
+func (r *redaction) apply(line []byte) []byte {
+	for _, re := range r.patterns {
+		matches := re.FindAllSubmatchIndex(line, -1)
+		if matches == nil {
+			continue
+		}
+
+		out := make([]byte, 0, len(line))
+		last := 0
+		for _, m := range matches {
+			spans := m[2:]
+			if len(spans) == 0 {
+				spans = m[:2]
+			}
+			for i := 0; i < len(spans); i += 2 {
+				start, end := spans[i], spans[i+1]
+				if start < last {
+					// Unmatched or nested group
+					continue
+				}
+				out = append(out, line[last:start]...)
+				out = append(out, Redacted...)
+				last = end
+			}
+		}
+		line = append(out, line[last:]...)
+	}
+	return line
+}
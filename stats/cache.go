@@ -0,0 +1,181 @@
+// Copyright (C) 2022 OpenRFSense
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Affero General Public License as
+// published by the Free Software Foundation, either version 3 of the
+// License, or (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU Affero General Public License for more details.
+//
+// You should have received a copy of the GNU Affero General Public License
+// along with this program.  If not, see <http://www.gnu.org/licenses/>.
+
+package stats
+
+import (
+	"context"
+	"reflect"
+	"sync"
+	"time"
+)
+
+var (
+	_ Provider        = &Cached{}
+	_ ContextProvider = &Cached{}
+	_ TimeoutProvider = &Cached{}
+	_ Initializer     = &Cached{}
+	_ Closer          = &Cached{}
+	_ MetricsProvider = &Cached{}
+)
+
+// Type StaleError is returned by Cached along with the last good stats when the
+// latest refresh failed. Stats.Provide stores both, so the value is still
+// reported and Stats.Errors marks it as stale.
+type StaleError struct {
+	// When the returned stats were collected
+	UpdatedAt time.Time
+
+	// The error returned by the failed refresh
+	Err error
+}
+
+func (e *StaleError) Error() string {
+	return "stale since " + e.UpdatedAt.UTC().Format(time.RFC3339) + ": " + e.Err.Error()
+}
+
+func (e *StaleError) Unwrap() error {
+	return e.Err
+}
+
+// Type Cached wraps an expensive provider, returning its last stats for a given
+// TTL. Once the TTL expires, the cached stats are still returned while a refresh
+// runs in the background. Only calls made before the first successful refresh
+// wait for the provider, and concurrent ones share a single call. Failed
+// refreshes are retried no sooner than one TTL later. New instances are to be
+// created with stats.NewCached().
+type Cached struct {
+	provider Provider
+	ttl      time.Duration
+
+	mu        sync.Mutex
+	value     interface{}
+	updated   time.Time
+	err       error
+	attempted time.Time
+	// Closed when the running refresh ends, nil if none is running
+	refreshing chan struct{}
+}
+
+// Creates a caching wrapper around p, which keeps stats for ttl.
+func NewCached(p Provider, ttl time.Duration) *Cached {
+	return &Cached{
+		provider: p,
+		ttl:      ttl,
+	}
+}
+
+// Returns the name of the wrapped provider.
+func (c *Cached) Name() string {
+	return c.provider.Name()
+}
+
+// Returns the cached stats, starting a background refresh if the last attempt is
+// older than the TTL. If the last refresh failed, the stats are returned with a
+// *StaleError. Until a refresh succeeds, the call waits for the running refresh
+// and returns its error.
+func (c *Cached) Stats() (interface{}, error) {
+	return c.StatsContext(context.Background())
+}
+
+// Same as Stats, but stops waiting for the running refresh once ctx is done. The
+// refresh itself keeps running, so that other callers can use its result.
+func (c *Cached) StatsContext(ctx context.Context) (interface{}, error) {
+	c.mu.Lock()
+	if c.refreshing == nil && time.Since(c.attempted) >= c.ttl {
+		c.refreshing = make(chan struct{})
+		go c.refresh(c.refreshing)
+	}
+	if refreshing := c.refreshing; c.updated.IsZero() && refreshing != nil {
+		c.mu.Unlock()
+		select {
+		case <-refreshing:
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		}
+		c.mu.Lock()
+	}
+
+	value, updated, err := c.value, c.updated, c.err
+	c.mu.Unlock()
+
+	switch {
+	case updated.IsZero():
+		return nil, err
+	case err != nil:
+		return value, &StaleError{UpdatedAt: updated, Err: err}
+	}
+	return value, nil
+}
+
+// Returns the timeout of the wrapped provider if it implements TimeoutProvider,
+// DefaultTimeout otherwise.
+func (c *Cached) Timeout() time.Duration {
+	if tp, ok := c.provider.(TimeoutProvider); ok {
+		return tp.Timeout()
+	}
+	return DefaultTimeout
+}
+
+// Calls the wrapped provider and stores the result, then closes done. On
+// failure, the previous stats are kept and the error is remembered. A wrapped
+// ContextProvider is interrupted after Timeout.
+func (c *Cached) refresh(done chan struct{}) {
+	var value interface{}
+	var err error
+	if cp, ok := c.provider.(ContextProvider); ok {
+		ctx, cancel := context.WithTimeout(context.Background(), c.Timeout())
+		value, err = cp.StatsContext(ctx)
+		cancel()
+	} else {
+		value, err = c.provider.Stats()
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.attempted = time.Now()
+	if err != nil {
+		c.err = err
+	} else {
+		c.value, c.updated, c.err = value, c.attempted, nil
+	}
+	c.refreshing = nil
+	close(done)
+}
+
+// Initializes the wrapped provider if it implements Initializer.
+func (c *Cached) Init() error {
+	if i, ok := c.provider.(Initializer); ok {
+		return i.Init()
+	}
+	return nil
+}
+
+// Closes the wrapped provider if it implements Closer.
+func (c *Cached) Close() error {
+	if cl, ok := c.provider.(Closer); ok {
+		return cl.Close()
+	}
+	return nil
+}
+
+// Returns the metrics of the wrapped provider, using the same defaults as
+// MetricsHandler if it does not implement MetricsProvider.
+func (c *Cached) Metrics(stats interface{}) []Metric {
+	if mp, ok := c.provider.(MetricsProvider); ok {
+		return mp.Metrics(stats)
+	}
+	return appendNumeric(nil, sanitizeName(snakeCase(c.Name())), reflect.ValueOf(stats))
+}
@@ -0,0 +1,209 @@
+// Copyright (C) 2022 OpenRFSense
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Affero General Public License as
+// published by the Free Software Foundation, either version 3 of the
+// License, or (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU Affero General Public License for more details.
+//
+// You should have received a copy of the GNU Affero General Public License
+// along with this program.  If not, see <http://www.gnu.org/licenses/>.
+
+package stats
+
+import (
+	"context"
+	"sync"
+	"time"
+)
+
+const (
+	// The number of snapshots kept by a Collector unless changed with WithHistory.
+	DefaultHistory = 60
+
+	// The interval used for providers registered with a non-positive interval.
+	DefaultInterval = time.Minute
+)
+
+// Type Snapshot is the state of the Stats held by a Collector after a collection.
+type Snapshot struct {
+	// When the collection finished
+	Time time.Time `json:"time"`
+
+	Stats Stats `json:"stats"`
+}
+
+// Type scheduled is a provider registered in a Collector.
+type scheduled struct {
+	provider Provider
+	interval time.Duration
+	next     time.Time
+}
+
+// Type Collector periodically runs providers, each on its own interval, and keeps
+// the last snapshots of the resulting Stats in a ring buffer. New instances are
+// to be created with stats.NewCollector() and configured before calling Run.
+// Latest and History are safe to call concurrently with Run.
+type Collector struct {
+	base      Stats
+	providers []scheduled
+
+	mu      sync.RWMutex
+	history []Snapshot
+	head    int
+	count   int
+}
+
+// Creates a new Collector with no providers, which keeps DefaultHistory snapshots.
+func NewCollector() *Collector {
+	return &Collector{
+		history: make([]Snapshot, DefaultHistory),
+	}
+}
+
+// Sets the Stats every snapshot is built on, usually containing the node identity.
+func (c *Collector) WithStats(base Stats) *Collector {
+	c.base = base
+	return c
+}
+
+// Sets the number of snapshots to keep. Values lower than 1 are treated as 1.
+func (c *Collector) WithHistory(size int) *Collector {
+	if size < 1 {
+		size = 1
+	}
+	c.history = make([]Snapshot, size)
+	c.head, c.count = 0, 0
+	return c
+}
+
+// Registers a provider to be run every interval (DefaultInterval if not positive).
+func (c *Collector) WithProvider(p Provider, interval time.Duration) *Collector {
+	if interval <= 0 {
+		interval = DefaultInterval
+	}
+	c.providers = append(c.providers, scheduled{
+		provider: p,
+		interval: interval,
+	})
+	return c
+}
+
+// Runs every provider once, then each again as soon as its interval expires,
+// until ctx is done. Providers due at the same time run in parallel, as with
+// Stats.ProvideContext. Always returns the context error.
+func (c *Collector) Run(ctx context.Context) error {
+	current := c.base.clone()
+
+	now := time.Now()
+	for i := range c.providers {
+		c.providers[i].next = now
+	}
+
+	timer := time.NewTimer(0)
+	defer timer.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case now = <-timer.C:
+		}
+
+		due := []Provider{}
+		next := time.Time{}
+		for i := range c.providers {
+			sp := &c.providers[i]
+			if !sp.next.After(now) {
+				due = append(due, sp.provider)
+				sp.next = now.Add(sp.interval)
+			}
+			if next.IsZero() || sp.next.Before(next) {
+				next = sp.next
+			}
+		}
+
+		if len(due) > 0 {
+			// Errors are recorded in current.Errors
+			_ = current.ProvideContext(ctx, due...)
+			if ctx.Err() != nil {
+				// Do not store a collection interrupted halfway
+				return ctx.Err()
+			}
+			c.push(Snapshot{
+				Time:  time.Now(),
+				Stats: current.clone(),
+			})
+		}
+
+		if next.IsZero() {
+			// No providers registered, nothing to do until ctx is done
+			<-ctx.Done()
+			return ctx.Err()
+		}
+		timer.Reset(time.Until(next))
+	}
+}
+
+// Returns the most recent snapshot and true, or false if nothing was collected yet.
+func (c *Collector) Latest() (Snapshot, bool) {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+
+	if c.count == 0 {
+		return Snapshot{}, false
+	}
+	last := (c.head - 1 + len(c.history)) % len(c.history)
+	return c.history[last], true
+}
+
+// Returns the stored snapshots, oldest first.
+func (c *Collector) History() []Snapshot {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+
+	ret := make([]Snapshot, c.count)
+	start := (c.head - c.count + len(c.history)) % len(c.history)
+	for i := range ret {
+		ret[i] = c.history[(start+i)%len(c.history)]
+	}
+	return ret
+}
+
+// Adds a snapshot to the ring buffer, overwriting the oldest one if full.
+func (c *Collector) push(s Snapshot) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.history[c.head] = s
+	c.head = (c.head + 1) % len(c.history)
+	if c.count < len(c.history) {
+		c.count++
+	}
+}
+
+// Returns a copy of s which does not share maps or slices with it. Provider
+// values themselves are not copied.
+func (s Stats) clone() Stats {
+	if s.Providers != nil {
+		providers := make(map[string]interface{}, len(s.Providers))
+		for k, v := range s.Providers {
+			providers[k] = v
+		}
+		s.Providers = providers
+	}
+	if s.Errors != nil {
+		errs := make(map[string]string, len(s.Errors))
+		for k, v := range s.Errors {
+			errs[k] = v
+		}
+		s.Errors = errs
+	}
+	if s.TimedOut != nil {
+		s.TimedOut = append([]string(nil), s.TimedOut...)
+	}
+	return s
+}
@@ -0,0 +1,133 @@
+// Copyright (C) 2022 OpenRFSense
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Affero General Public License as
+// published by the Free Software Foundation, either version 3 of the
+// License, or (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU Affero General Public License for more details.
+//
+// You should have received a copy of the GNU Affero General Public License
+// along with this program.  If not, see <http://www.gnu.org/licenses/>.
+
+package stats
+
+import (
+	"context"
+	"sync"
+	"time"
+)
+
+// The timeout applied by ProvideContext to providers which do not implement
+// TimeoutProvider.
+var DefaultTimeout = 5 * time.Second
+
+// Interface ContextProvider describes a provider which can be interrupted. It is
+// preferred over Provider.Stats by ProvideContext.
+type ContextProvider interface {
+	Provider
+
+	// Same as Provider.Stats, but should return as soon as possible once ctx is done.
+	StatsContext(ctx context.Context) (interface{}, error)
+}
+
+// Interface TimeoutProvider describes a provider which needs a timeout other than
+// DefaultTimeout.
+type TimeoutProvider interface {
+	Provider
+
+	// Returns the maximum amount of time the provider is allowed to run for.
+	Timeout() time.Duration
+}
+
+// Type result holds the outcome of a single provider execution.
+type result struct {
+	stats    interface{}
+	err      error
+	timedOut bool
+}
+
+// Executes the given providers in parallel and stores the returned stats in
+// Stats.Providers. Each provider runs with its own timeout, derived from ctx.
+// Providers which did not return in time are listed in Stats.TimedOut (once,
+// until they return in time again) and their stats are left nil. Errors are
+// reported as in Provide. Plain providers cannot be interrupted: their goroutine
+// keeps running in the background until Provider.Stats returns.
+func (s *Stats) ProvideContext(ctx context.Context, providers ...Provider) error {
+	if len(providers) == 0 {
+		return nil
+	}
+
+	results := make([]result, len(providers))
+	wg := sync.WaitGroup{}
+	wg.Add(len(providers))
+	for i, p := range providers {
+		go func(i int, p Provider) {
+			defer wg.Done()
+			results[i] = run(ctx, p)
+		}(i, p)
+	}
+	wg.Wait()
+
+	var errs ProviderErrors
+	for i, p := range providers {
+		s.markTimedOut(p.Name(), results[i].timedOut)
+		errs = s.record(p.Name(), results[i].stats, results[i].err, errs)
+	}
+
+	return errs.orNil()
+}
+
+// Lists the provider in TimedOut if it timed out, removes it otherwise.
+func (s *Stats) markTimedOut(name string, timedOut bool) {
+	kept := s.TimedOut[:0]
+	for _, n := range s.TimedOut {
+		if n != name {
+			kept = append(kept, n)
+		}
+	}
+	if timedOut {
+		kept = append(kept, name)
+	}
+	if len(kept) == 0 {
+		kept = nil
+	}
+	s.TimedOut = kept
+}
+
+// Runs a single provider, giving up once its timeout expires.
+func run(ctx context.Context, p Provider) result {
+	timeout := DefaultTimeout
+	if tp, ok := p.(TimeoutProvider); ok {
+		timeout = tp.Timeout()
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+
+	done := make(chan result, 1)
+	go func() {
+		var res result
+		if cp, ok := p.(ContextProvider); ok {
+			res.stats, res.err = cp.StatsContext(ctx)
+		} else {
+			res.stats, res.err = p.Stats()
+		}
+		done <- res
+	}()
+
+	select {
+	case res := <-done:
+		// A ContextProvider may notice the deadline before we do
+		res.timedOut = res.err != nil && ctx.Err() != nil
+		return res
+	case <-ctx.Done():
+		return result{
+			err:      ctx.Err(),
+			timedOut: true,
+		}
+	}
+}
@@ -0,0 +1,108 @@
+// Copyright (C) 2022 OpenRFSense
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Affero General Public License as
+// published by the Free Software Foundation, either version 3 of the
+// License, or (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU Affero General Public License for more details.
+//
+// You should have received a copy of the GNU Affero General Public License
+// along with this program.  If not, see <http://www.gnu.org/licenses/>.
+
+package stats
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"reflect"
+	"sync"
+)
+
+// Maps provider names to the Go type of the value returned by their Stats method.
+var providerTypes = struct {
+	sync.RWMutex
+	types map[string]reflect.Type
+}{
+	types: make(map[string]reflect.Type),
+}
+
+// Registers the type of the stats returned by the provider with the given name,
+// so that Stats.UnmarshalJSON can decode them into a value of the same type.
+// sample is any value of that type, for example RegisterType("fs", []statsFs{}).
+// Registering a name twice replaces the previous type.
+func RegisterType(name string, sample interface{}) {
+	if sample == nil {
+		panic("stats: RegisterType sample is nil for provider " + name)
+	}
+
+	providerTypes.Lock()
+	defer providerTypes.Unlock()
+	providerTypes.types[name] = reflect.TypeOf(sample)
+}
+
+// Returns the type registered for the given provider name, if any.
+func registeredType(name string) (reflect.Type, bool) {
+	providerTypes.RLock()
+	defer providerTypes.RUnlock()
+	t, ok := providerTypes.types[name]
+	return t, ok
+}
+
+// Decodes Stats from JSON. Provider entries whose type was registered with
+// RegisterType are decoded into that type, while unknown ones are stored as
+// json.RawMessage so they can be decoded later or re-encoded unchanged. Uptime
+// is read from "uptimeSeconds" if present, otherwise from "uptime" either as an
+// ISO 8601 duration or as nanoseconds (the format used by older versions).
+func (s *Stats) UnmarshalJSON(data []byte) error {
+	type plain Stats
+	aux := struct {
+		*plain
+		Uptime        json.RawMessage            `json:"uptime"`
+		UptimeSeconds *float64                   `json:"uptimeSeconds"`
+		Providers     map[string]json.RawMessage `json:"providers,omitempty"`
+	}{
+		plain: (*plain)(s),
+	}
+
+	if err := json.Unmarshal(data, &aux); err != nil {
+		return err
+	}
+
+	uptime, err := decodeUptime(aux.Uptime, aux.UptimeSeconds)
+	if err != nil {
+		return err
+	}
+	s.Uptime = uptime
+
+	if aux.Providers == nil {
+		s.Providers = nil
+		return nil
+	}
+
+	s.Providers = make(map[string]interface{}, len(aux.Providers))
+	for name, raw := range aux.Providers {
+		if bytes.Equal(raw, []byte("null")) {
+			s.Providers[name] = nil
+			continue
+		}
+
+		t, ok := registeredType(name)
+		if !ok {
+			s.Providers[name] = raw
+			continue
+		}
+
+		ptr := reflect.New(t)
+		if err := json.Unmarshal(raw, ptr.Interface()); err != nil {
+			return fmt.Errorf("decoding stats of provider %s: %w", name, err)
+		}
+		s.Providers[name] = ptr.Elem().Interface()
+	}
+
+	return nil
+}
@@ -0,0 +1,349 @@
+// Copyright (C) 2022 OpenRFSense
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Affero General Public License as
+// published by the Free Software Foundation, either version 3 of the
+// License, or (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU Affero General Public License for more details.
+//
+// You should have received a copy of the GNU Affero General Public License
+// along with this program.  If not, see <http://www.gnu.org/licenses/>.
+
+package stats
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"reflect"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// A ChangeType describes how a value differs between two snapshots. Values match
+// the RFC 6902 operation names.
+type ChangeType string
+
+const (
+	// The value is only present in the newer snapshot.
+	Added ChangeType = "add"
+	// The value is only present in the older snapshot.
+	Removed ChangeType = "remove"
+	// The value is present in both snapshots, but differs.
+	Changed ChangeType = "replace"
+)
+
+// Type Change is a single difference between two Stats, as found by Diff. Old and
+// New are in the generic form of encoding/json, with numbers as json.Number.
+type Change struct {
+	Type ChangeType
+
+	// Location of the value as a JSON pointer (RFC 6901) into the JSON encoding
+	// of Stats, such as "/providers/memory/free"
+	Path string
+
+	// Value in the older snapshot, nil if added
+	Old interface{}
+
+	// Value in the newer snapshot, nil if removed
+	New interface{}
+}
+
+// Type Changes is the list of differences returned by Diff.
+type Changes []Change
+
+// Type Operation is a single RFC 6902 JSON patch operation.
+type Operation struct {
+	Op    ChangeType  `json:"op"`
+	Path  string      `json:"path"`
+	Value interface{} `json:"value"`
+}
+
+// JSON members of Stats which change between any two reports, ignored by Diff.
+var volatileMembers = []string{"uptime", "uptimeSeconds", "bootTime"}
+
+// Compares two snapshots and returns the changes needed to go from prev to next.
+// Values are compared in their JSON form, so provider stats of any type (including
+// nested ones) are compared field by field. Uptime and BootTime are not
+// compared, since they change between any two reports: a reboot shows as a
+// smaller Uptime.
+func Diff(prev Stats, next Stats) (Changes, error) {
+	a, err := toGeneric(prev)
+	if err != nil {
+		return nil, err
+	}
+	b, err := toGeneric(next)
+	if err != nil {
+		return nil, err
+	}
+
+	for _, doc := range []interface{}{a, b} {
+		if m, ok := doc.(map[string]interface{}); ok {
+			for _, k := range volatileMembers {
+				delete(m, k)
+			}
+		}
+	}
+
+	return diffValues(nil, "", a, b), nil
+}
+
+// Renders the changes as an RFC 6902 JSON patch document.
+func (c Changes) JSONPatch() ([]byte, error) {
+	ops := make([]Operation, len(c))
+	for i, change := range c {
+		ops[i] = Operation{Op: change.Type, Path: change.Path, Value: change.New}
+	}
+	return json.Marshal(ops)
+}
+
+// Removes the "value" member from remove operations, keeps it (even if null)
+// for every other operation.
+func (o Operation) MarshalJSON() ([]byte, error) {
+	if o.Op == Removed {
+		return json.Marshal(struct {
+			Op   ChangeType `json:"op"`
+			Path string     `json:"path"`
+		}{o.Op, o.Path})
+	}
+	type plain Operation
+	return json.Marshal(struct {
+		plain
+		Value interface{} `json:"value"`
+	}{plain(o), o.Value})
+}
+
+// Applies an RFC 6902 JSON patch, such as one returned by Changes.JSONPatch, to s
+// and returns the result. Only the add, remove and replace operations are
+// supported. s is not modified.
+func ApplyPatch(s Stats, patch []byte) (Stats, error) {
+	ops := []Operation{}
+	if err := decodeGeneric(patch, &ops); err != nil {
+		return Stats{}, fmt.Errorf("decoding patch: %w", err)
+	}
+
+	doc, err := toGeneric(s)
+	if err != nil {
+		return Stats{}, err
+	}
+
+	for _, op := range ops {
+		tokens, err := parsePointer(op.Path)
+		if err != nil {
+			return Stats{}, err
+		}
+		if doc, err = applyOperation(doc, tokens, op); err != nil {
+			return Stats{}, fmt.Errorf("applying %s %s: %w", op.Op, op.Path, err)
+		}
+	}
+
+	raw, err := json.Marshal(doc)
+	if err != nil {
+		return Stats{}, err
+	}
+	ret := Stats{}
+	err = json.Unmarshal(raw, &ret)
+	return ret, err
+}
+
+// Converts v to the generic form produced by encoding/json (maps, slices,
+// json.Number, string, bool and nil).
+func toGeneric(v interface{}) (interface{}, error) {
+	raw, err := json.Marshal(v)
+	if err != nil {
+		return nil, err
+	}
+	var ret interface{}
+	err = decodeGeneric(raw, &ret)
+	return ret, err
+}
+
+// Decodes data into v keeping numbers as json.Number, so that integers above
+// 2^53 (such as uint64 counters) are not rounded to the nearest float64.
+func decodeGeneric(data []byte, v interface{}) error {
+	d := json.NewDecoder(bytes.NewReader(data))
+	d.UseNumber()
+	if err := d.Decode(v); err != nil {
+		return err
+	}
+	if _, err := d.Token(); err != io.EOF {
+		return errors.New("invalid data after the top-level value")
+	}
+	return nil
+}
+
+// Appends to changes the differences between the generic values a and b, found
+// at the given path.
+func diffValues(changes Changes, path string, a interface{}, b interface{}) Changes {
+	switch a := a.(type) {
+	case map[string]interface{}:
+		b, ok := b.(map[string]interface{})
+		if !ok {
+			break
+		}
+
+		keys := make([]string, 0, len(a)+len(b))
+		for k := range a {
+			keys = append(keys, k)
+		}
+		for k := range b {
+			if _, ok := a[k]; !ok {
+				keys = append(keys, k)
+			}
+		}
+		sort.Strings(keys)
+
+		for _, k := range keys {
+			av, inA := a[k]
+			bv, inB := b[k]
+			child := path + "/" + escapePointer(k)
+			switch {
+			case !inA:
+				changes = append(changes, Change{Type: Added, Path: child, New: bv})
+			case !inB:
+				changes = append(changes, Change{Type: Removed, Path: child, Old: av})
+			default:
+				changes = diffValues(changes, child, av, bv)
+			}
+		}
+		return changes
+
+	case []interface{}:
+		b, ok := b.([]interface{})
+		if !ok {
+			break
+		}
+
+		common := len(a)
+		if len(b) < common {
+			common = len(b)
+		}
+		for i := 0; i < common; i++ {
+			changes = diffValues(changes, path+"/"+strconv.Itoa(i), a[i], b[i])
+		}
+		for i := common; i < len(b); i++ {
+			changes = append(changes, Change{Type: Added, Path: path + "/" + strconv.Itoa(i), New: b[i]})
+		}
+		// Remove from the end, so that indexes stay valid when applied in order
+		for i := len(a) - 1; i >= common; i-- {
+			changes = append(changes, Change{Type: Removed, Path: path + "/" + strconv.Itoa(i), Old: a[i]})
+		}
+		return changes
+	}
+
+	if !reflect.DeepEqual(a, b) {
+		changes = append(changes, Change{Type: Changed, Path: path, Old: a, New: b})
+	}
+	return changes
+}
+
+// Escapes a key for use as a JSON pointer reference token.
+func escapePointer(s string) string {
+	return strings.NewReplacer("~", "~0", "/", "~1").Replace(s)
+}
+
+// Splits a JSON pointer into its unescaped reference tokens.
+func parsePointer(pointer string) ([]string, error) {
+	if pointer == "" {
+		return nil, nil
+	}
+	if !strings.HasPrefix(pointer, "/") {
+		return nil, fmt.Errorf("invalid JSON pointer %q", pointer)
+	}
+
+	tokens := strings.Split(pointer[1:], "/")
+	r := strings.NewReplacer("~1", "/", "~0", "~")
+	for i, t := range tokens {
+		tokens[i] = r.Replace(t)
+	}
+	return tokens, nil
+}
+
+// Applies op to the value found following tokens from doc, returning the new doc.
+func applyOperation(doc interface{}, tokens []string, op Operation) (interface{}, error) {
+	if len(tokens) == 0 {
+		switch op.Op {
+		case Added, Changed:
+			return op.Value, nil
+		default:
+			return nil, fmt.Errorf("cannot %s the whole document", op.Op)
+		}
+	}
+
+	token := tokens[0]
+	last := len(tokens) == 1
+	switch container := doc.(type) {
+	case map[string]interface{}:
+		current, exists := container[token]
+		if !last {
+			if !exists {
+				return nil, fmt.Errorf("path not found at %q", token)
+			}
+			child, err := applyOperation(current, tokens[1:], op)
+			if err != nil {
+				return nil, err
+			}
+			container[token] = child
+			return container, nil
+		}
+
+		switch op.Op {
+		case Added:
+			container[token] = op.Value
+		case Changed, Removed:
+			if !exists {
+				return nil, fmt.Errorf("path not found at %q", token)
+			}
+			if op.Op == Removed {
+				delete(container, token)
+			} else {
+				container[token] = op.Value
+			}
+		default:
+			return nil, fmt.Errorf("unsupported operation %q", op.Op)
+		}
+		return container, nil
+
+	case []interface{}:
+		if last && op.Op == Added && token == "-" {
+			return append(container, op.Value), nil
+		}
+		i, err := strconv.Atoi(token)
+		if err != nil || i < 0 || i > len(container) || (i == len(container) && !(last && op.Op == Added)) {
+			return nil, fmt.Errorf("invalid array index %q", token)
+		}
+
+		if !last {
+			child, err := applyOperation(container[i], tokens[1:], op)
+			if err != nil {
+				return nil, err
+			}
+			container[i] = child
+			return container, nil
+		}
+
+		switch op.Op {
+		case Added:
+			container = append(container, nil)
+			copy(container[i+1:], container[i:])
+			container[i] = op.Value
+		case Removed:
+			container = append(container[:i], container[i+1:]...)
+		case Changed:
+			container[i] = op.Value
+		default:
+			return nil, fmt.Errorf("unsupported operation %q", op.Op)
+		}
+		return container, nil
+
+	default:
+		return nil, fmt.Errorf("cannot traverse a scalar at %q", token)
+	}
+}
@@ -0,0 +1,80 @@
+// Copyright (C) 2022 OpenRFSense
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Affero General Public License as
+// published by the Free Software Foundation, either version 3 of the
+// License, or (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU Affero General Public License for more details.
+//
+// You should have received a copy of the GNU Affero General Public License
+// along with this program.  If not, see <http://www.gnu.org/licenses/>.
+
+package stats
+
+import (
+	"errors"
+	"strings"
+)
+
+// Type ProviderError is returned when a single provider fails.
+type ProviderError struct {
+	// Name of the failed provider, as returned by Provider.Name
+	Provider string
+
+	// The error returned by the provider (or the context error on timeout)
+	Err error
+}
+
+func (e *ProviderError) Error() string {
+	return "provider " + e.Provider + ": " + e.Err.Error()
+}
+
+func (e *ProviderError) Unwrap() error {
+	return e.Err
+}
+
+// Type ProviderErrors bundles the errors of all the providers which failed during
+// a single Provide/ProvideContext call, in the order the providers were given.
+// errors.Is and errors.As are matched against each of the contained errors.
+type ProviderErrors []*ProviderError
+
+func (e ProviderErrors) Error() string {
+	msgs := make([]string, len(e))
+	for i, err := range e {
+		msgs[i] = err.Error()
+	}
+	return strings.Join(msgs, "; ")
+}
+
+// Reports whether any of the provider errors matches target.
+func (e ProviderErrors) Is(target error) bool {
+	for _, err := range e {
+		if errors.Is(err, target) {
+			return true
+		}
+	}
+	return false
+}
+
+// Finds the first provider error which matches target, and if so, sets target
+// to that error value and returns true.
+func (e ProviderErrors) As(target interface{}) bool {
+	for _, err := range e {
+		if errors.As(err, target) {
+			return true
+		}
+	}
+	return false
+}
+
+// Returns the bundle as an error, or an untyped nil if it is empty.
+func (e ProviderErrors) orNil() error {
+	if len(e) == 0 {
+		return nil
+	}
+	return e
+}
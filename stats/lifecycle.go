@@ -0,0 +1,146 @@
+// Copyright (C) 2022 OpenRFSense
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Affero General Public License as
+// published by the Free Software Foundation, either version 3 of the
+// License, or (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU Affero General Public License for more details.
+//
+// You should have received a copy of the GNU Affero General Public License
+// along with this program.  If not, see <http://www.gnu.org/licenses/>.
+
+package stats
+
+import (
+	"sort"
+	"sync"
+)
+
+// Interface Initializer describes a provider which needs to be set up once (for
+// example to open a device handle) before its Stats method is called.
+type Initializer interface {
+	Init() error
+}
+
+// Interface Closer describes a provider which holds resources to be released
+// once it is no longer used.
+type Closer interface {
+	Close() error
+}
+
+// Providers registered globally with Register.
+var registered = struct {
+	sync.Mutex
+	providers map[string]Provider
+}{
+	providers: make(map[string]Provider),
+}
+
+// Makes a provider available through Registered. Meant to be called in the init
+// function of the package implementing the provider, as done by database/sql
+// drivers. Panics if p is nil or if a provider with the same name was already
+// registered.
+func Register(p Provider) {
+	if p == nil {
+		panic("stats: Register provider is nil")
+	}
+
+	registered.Lock()
+	defer registered.Unlock()
+
+	name := p.Name()
+	if _, dup := registered.providers[name]; dup {
+		panic("stats: Register called twice for provider " + name)
+	}
+	registered.providers[name] = p
+}
+
+// Returns the providers registered with Register, sorted by name.
+func Registered() []Provider {
+	registered.Lock()
+	defer registered.Unlock()
+
+	names := make([]string, 0, len(registered.providers))
+	for name := range registered.providers {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	ret := make([]Provider, len(names))
+	for i, name := range names {
+		ret[i] = registered.providers[name]
+	}
+	return ret
+}
+
+// Type Set is a group of providers which are initialized and closed together,
+// honoring the optional Initializer and Closer interfaces. New instances are to
+// be created with stats.NewSet().
+type Set struct {
+	mu          sync.Mutex
+	providers   []Provider
+	initialized int
+}
+
+// Creates a Set with the given providers. Use NewSet(Registered()...) to get a
+// set of all the globally registered providers.
+func NewSet(providers ...Provider) *Set {
+	return &Set{
+		providers: providers,
+	}
+}
+
+// Returns the providers in the set, to be passed to Stats.Provide or a Collector.
+func (s *Set) Providers() []Provider {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return append([]Provider(nil), s.providers...)
+}
+
+// Calls Init on every provider implementing Initializer, in order. If one fails,
+// the providers initialized so far are closed and a *ProviderError is returned.
+// Calling Init again after a success does nothing.
+func (s *Set) Init() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for s.initialized < len(s.providers) {
+		p := s.providers[s.initialized]
+		if i, ok := p.(Initializer); ok {
+			if err := i.Init(); err != nil {
+				_ = s.close()
+				return &ProviderError{Provider: p.Name(), Err: err}
+			}
+		}
+		s.initialized++
+	}
+
+	return nil
+}
+
+// Calls Close on every initialized provider implementing Closer, in reverse
+// order. All providers are closed even if some fail, in which case the errors
+// are returned as ProviderErrors. The set can be initialized again afterwards.
+func (s *Set) Close() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.close()
+}
+
+// Closes the initialized providers. Must be called with s.mu held.
+func (s *Set) close() error {
+	var errs ProviderErrors
+	for ; s.initialized > 0; s.initialized-- {
+		p := s.providers[s.initialized-1]
+		if c, ok := p.(Closer); ok {
+			if err := c.Close(); err != nil {
+				errs = append(errs, &ProviderError{Provider: p.Name(), Err: err})
+			}
+		}
+	}
+	return errs.orNil()
+}
@@ -0,0 +1,432 @@
+// Copyright (C) 2022 OpenRFSense
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Affero General Public License as
+// published by the Free Software Foundation, either version 3 of the
+// License, or (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU Affero General Public License for more details.
+//
+// You should have received a copy of the GNU Affero General Public License
+// along with this program.  If not, see <http://www.gnu.org/licenses/>.
+
+package stats
+
+import (
+	"bufio"
+	"math"
+	"net/http"
+	"reflect"
+	"sort"
+	"strconv"
+	"strings"
+	"unicode"
+)
+
+// Prefix added to the name of every exposed metric.
+const Namespace = "openrfsense"
+
+const (
+	contentTypeOpenMetrics = "application/openmetrics-text; version=1.0.0; charset=utf-8"
+	contentTypeText        = "text/plain; version=0.0.4; charset=utf-8"
+)
+
+// A MetricType is the type of a metric as understood by Prometheus.
+type MetricType string
+
+const (
+	// A value which can go up and down.
+	Gauge MetricType = "gauge"
+	// A monotonically increasing value.
+	Counter MetricType = "counter"
+	// A distribution of observations. Each sample of the family is a separate
+	// Metric, whose Name ends with "_bucket" (with an "le" label), "_sum" or
+	// "_count".
+	Histogram MetricType = "histogram"
+)
+
+// Suffixes of the samples of a histogram family.
+var histogramSuffixes = []string{"_bucket", "_sum", "_count"}
+
+// Type Metric is a single sample exposed to Prometheus.
+type Metric struct {
+	// Name of the metric, without Namespace and, for counters, without the
+	// "_total" suffix
+	Name string
+
+	// Optional description of the metric
+	Help string
+
+	// Gauge if empty
+	Type MetricType
+
+	// Labels for this sample, in addition to the node ID
+	Labels map[string]string
+
+	Value float64
+}
+
+// Interface MetricsProvider describes a provider which declares how its stats are
+// exposed to Prometheus. Providers which do not implement it have their numeric
+// values (and the numeric fields of structs and maps) exposed as gauges, see
+// appendNumeric.
+type MetricsProvider interface {
+	Provider
+
+	// Returns the metrics for the given value, previously returned by Stats.
+	Metrics(stats interface{}) []Metric
+}
+
+// Type MetricsHandler is an http.Handler which renders Stats in the Prometheus
+// text format or, if the client asks for it, as OpenMetrics. New instances are
+// to be created with stats.NewMetricsHandler().
+type MetricsHandler struct {
+	source    func() Stats
+	providers map[string]MetricsProvider
+}
+
+// Creates a new MetricsHandler which calls source on every request to get the
+// Stats to render, for example the Stats of the Snapshot returned by
+// Collector.Latest. providers should include every provider implementing
+// MetricsProvider whose stats can appear in the result.
+func NewMetricsHandler(source func() Stats, providers ...Provider) *MetricsHandler {
+	h := &MetricsHandler{
+		source:    source,
+		providers: make(map[string]MetricsProvider),
+	}
+	for _, p := range providers {
+		if mp, ok := p.(MetricsProvider); ok {
+			h.providers[mp.Name()] = mp
+		}
+	}
+	return h
+}
+
+func (h *MetricsHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	openMetrics := strings.Contains(r.Header.Get("Accept"), "application/openmetrics-text")
+	if openMetrics {
+		w.Header().Set("Content-Type", contentTypeOpenMetrics)
+	} else {
+		w.Header().Set("Content-Type", contentTypeText)
+	}
+
+	bw := bufio.NewWriter(w)
+	writeMetrics(bw, h.metrics(h.source()), openMetrics)
+	_ = bw.Flush()
+}
+
+// Returns all the metrics for s, including node information.
+func (h *MetricsHandler) metrics(s Stats) []Metric {
+	ret := []Metric{
+		{
+			Name:   "node_info",
+			Help:   "Node identity, always 1.",
+			Labels: map[string]string{"hostname": s.Hostname, "model": s.Model},
+			Value:  1,
+		},
+		{
+			Name:  "node_uptime_seconds",
+			Help:  "Uptime of the node.",
+			Value: s.Uptime.Seconds(),
+		},
+	}
+
+	names := make([]string, 0, len(s.Providers))
+	for name := range s.Providers {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	for _, name := range names {
+		value := s.Providers[name]
+		if mp, ok := h.providers[name]; ok {
+			ret = append(ret, mp.Metrics(value)...)
+			continue
+		}
+		ret = appendNumeric(ret, sanitizeName(snakeCase(name)), reflect.ValueOf(value))
+	}
+
+	for i := range ret {
+		labels := make(map[string]string, len(ret[i].Labels)+1)
+		for k, v := range ret[i].Labels {
+			labels[k] = v
+		}
+		labels["id"] = s.ID
+		ret[i].Labels = labels
+	}
+
+	return ret
+}
+
+// Appends a gauge for v if it is a number, or for each numeric field if v is a
+// struct or a map with string keys. Elements of slices are appended the same
+// way, labeled with the string fields of the element (such as the device of a
+// filesystem) or, if there are none, with their index. Anything else is
+// ignored.
+func appendNumeric(metrics []Metric, name string, v reflect.Value) []Metric {
+	for v.Kind() == reflect.Pointer || v.Kind() == reflect.Interface {
+		if v.IsNil() {
+			return metrics
+		}
+		v = v.Elem()
+	}
+
+	if value, ok := numeric(v); ok {
+		return append(metrics, Metric{Name: name, Value: value})
+	}
+
+	switch v.Kind() {
+	case reflect.Slice, reflect.Array:
+		for i := 0; i < v.Len(); i++ {
+			elem := v.Index(i)
+			labels := stringFields(elem)
+			if len(labels) == 0 {
+				labels = map[string]string{"index": strconv.Itoa(i)}
+			}
+			start := len(metrics)
+			metrics = appendNumeric(metrics, name, elem)
+			for j := start; j < len(metrics); j++ {
+				metrics[j].Labels = labels
+			}
+		}
+	case reflect.Struct:
+		t := v.Type()
+		for i := 0; i < t.NumField(); i++ {
+			field := t.Field(i)
+			if !field.IsExported() {
+				continue
+			}
+			fieldName := field.Name
+			if tag, _, _ := strings.Cut(field.Tag.Get("json"), ","); tag == "-" {
+				continue
+			} else if tag != "" {
+				fieldName = tag
+			}
+			if value, ok := numeric(v.Field(i)); ok {
+				metrics = append(metrics, Metric{
+					Name:  name + "_" + sanitizeName(snakeCase(fieldName)),
+					Value: value,
+				})
+			}
+		}
+	case reflect.Map:
+		if v.Type().Key().Kind() != reflect.String {
+			return metrics
+		}
+		keys := v.MapKeys()
+		sort.Slice(keys, func(i, j int) bool {
+			return keys[i].String() < keys[j].String()
+		})
+		for _, key := range keys {
+			if value, ok := numeric(v.MapIndex(key)); ok {
+				metrics = append(metrics, Metric{
+					Name:  name + "_" + sanitizeName(snakeCase(key.String())),
+					Value: value,
+				})
+			}
+		}
+	}
+
+	return metrics
+}
+
+// Returns the string fields of v, if it is a struct, as labels named after the
+// fields.
+func stringFields(v reflect.Value) map[string]string {
+	for v.Kind() == reflect.Pointer || v.Kind() == reflect.Interface {
+		if v.IsNil() {
+			return nil
+		}
+		v = v.Elem()
+	}
+	if v.Kind() != reflect.Struct {
+		return nil
+	}
+
+	ret := map[string]string{}
+	t := v.Type()
+	for i := 0; i < t.NumField(); i++ {
+		field := t.Field(i)
+		if !field.IsExported() || field.Type.Kind() != reflect.String {
+			continue
+		}
+		fieldName := field.Name
+		if tag, _, _ := strings.Cut(field.Tag.Get("json"), ","); tag == "-" {
+			continue
+		} else if tag != "" {
+			fieldName = tag
+		}
+		ret[sanitizeName(snakeCase(fieldName))] = v.Field(i).String()
+	}
+	return ret
+}
+
+// Returns the value of v as a float64 if it is a number or a boolean.
+func numeric(v reflect.Value) (float64, bool) {
+	if v.Kind() == reflect.Interface && !v.IsNil() {
+		v = v.Elem()
+	}
+
+	switch v.Kind() {
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return float64(v.Int()), true
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64, reflect.Uintptr:
+		return float64(v.Uint()), true
+	case reflect.Float32, reflect.Float64:
+		return v.Float(), true
+	case reflect.Bool:
+		if v.Bool() {
+			return 1, true
+		}
+		return 0, true
+	default:
+		return 0, false
+	}
+}
+
+// Type family groups the samples of metrics sharing the same name.
+type family struct {
+	typ     MetricType
+	help    string
+	samples []Metric
+}
+
+// Writes the metrics in the text exposition format, grouped by name and sorted.
+func writeMetrics(w *bufio.Writer, metrics []Metric, openMetrics bool) {
+	families := map[string]*family{}
+	names := []string{}
+	for _, m := range metrics {
+		name := Namespace + "_" + sanitizeName(m.Name)
+		if m.Type == Histogram {
+			for _, suffix := range histogramSuffixes {
+				if strings.HasSuffix(name, suffix) {
+					name = strings.TrimSuffix(name, suffix)
+					break
+				}
+			}
+		}
+		f, ok := families[name]
+		if !ok {
+			typ := m.Type
+			if typ == "" {
+				typ = Gauge
+			}
+			f = &family{typ: typ}
+			families[name] = f
+			names = append(names, name)
+		}
+		if f.help == "" {
+			f.help = m.Help
+		}
+		f.samples = append(f.samples, m)
+	}
+	sort.Strings(names)
+
+	for _, name := range names {
+		f := families[name]
+		sampleName := name
+		if f.typ == Counter {
+			sampleName += "_total"
+			if !openMetrics {
+				name = sampleName
+			}
+		}
+
+		if f.help != "" {
+			w.WriteString("# HELP " + name + " " + helpEscaper.Replace(f.help) + "\n")
+		}
+		w.WriteString("# TYPE " + name + " " + string(f.typ) + "\n")
+		for _, s := range f.samples {
+			if f.typ == Histogram {
+				sampleName = Namespace + "_" + sanitizeName(s.Name)
+			}
+			w.WriteString(sampleName)
+			writeLabels(w, s.Labels)
+			w.WriteByte(' ')
+			w.WriteString(formatValue(s.Value))
+			w.WriteByte('\n')
+		}
+	}
+
+	if openMetrics {
+		w.WriteString("# EOF\n")
+	}
+}
+
+// Writes labels sorted by name, as {a="1",b="2"}.
+func writeLabels(w *bufio.Writer, labels map[string]string) {
+	if len(labels) == 0 {
+		return
+	}
+
+	keys := make([]string, 0, len(labels))
+	for k := range labels {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+
+	w.WriteByte('{')
+	for i, k := range keys {
+		if i > 0 {
+			w.WriteByte(',')
+		}
+		w.WriteString(sanitizeName(k))
+		w.WriteString(`="`)
+		w.WriteString(labelEscaper.Replace(labels[k]))
+		w.WriteByte('"')
+	}
+	w.WriteByte('}')
+}
+
+// Formats a sample value, using the special names for non-finite numbers.
+func formatValue(v float64) string {
+	switch {
+	case math.IsNaN(v):
+		return "NaN"
+	case math.IsInf(v, 1):
+		return "+Inf"
+	case math.IsInf(v, -1):
+		return "-Inf"
+	default:
+		return strconv.FormatFloat(v, 'g', -1, 64)
+	}
+}
+
+// Escape backslashes and newlines in help texts, as well as double quotes in
+// label values.
+var (
+	helpEscaper  = strings.NewReplacer(`\`, `\\`, "\n", `\n`)
+	labelEscaper = strings.NewReplacer(`\`, `\\`, "\n", `\n`, `"`, `\"`)
+)
+
+// Replaces every character not allowed in metric and label names with '_'.
+func sanitizeName(s string) string {
+	return strings.Map(func(r rune) rune {
+		if r == '_' || r == ':' || (r < unicode.MaxASCII && (unicode.IsLetter(r) || unicode.IsDigit(r))) {
+			return r
+		}
+		return '_'
+	}, s)
+}
+
+// Converts camelCase to snake_case.
+func snakeCase(s string) string {
+	b := strings.Builder{}
+	prevLower := false
+	for _, r := range s {
+		if unicode.IsUpper(r) {
+			if prevLower {
+				b.WriteByte('_')
+			}
+			b.WriteRune(unicode.ToLower(r))
+			prevLower = false
+			continue
+		}
+		b.WriteRune(r)
+		prevLower = unicode.IsLower(r) || unicode.IsDigit(r)
+	}
+	return b.String()
+}
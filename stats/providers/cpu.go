@@ -0,0 +1,113 @@
+// Copyright (C) 2022 OpenRFSense
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Affero General Public License as
+// published by the Free Software Foundation, either version 3 of the
+// License, or (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU Affero General Public License for more details.
+//
+// You should have received a copy of the GNU Affero General Public License
+// along with this program.  If not, see <http://www.gnu.org/licenses/>.
+
+package providers
+
+import (
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// Type CPUStats contains the time spent by all CPUs in each state, in USER_HZ
+// (usually hundredths of a second), as reported by /proc/stat.
+type CPUStats struct {
+	// Number of CPU cores
+	Cores int `json:"cores"`
+
+	// Fraction of time (0 to 1) the CPUs were busy since the previous call, or
+	// since boot on the first call
+	Usage float64 `json:"usage"`
+
+	User    uint64 `json:"user"`
+	Nice    uint64 `json:"nice"`
+	System  uint64 `json:"system"`
+	Idle    uint64 `json:"idle"`
+	IOWait  uint64 `json:"iowait"`
+	IRQ     uint64 `json:"irq"`
+	SoftIRQ uint64 `json:"softirq"`
+	Steal   uint64 `json:"steal"`
+}
+
+// Returns the total and idle time of all CPUs.
+func (c CPUStats) times() (total uint64, idle uint64) {
+	total = c.User + c.Nice + c.System + c.Idle + c.IOWait + c.IRQ + c.SoftIRQ + c.Steal
+	return total, c.Idle + c.IOWait
+}
+
+// Type CPU provides CPU usage from /proc/stat. Since usage is computed against
+// the previous call, it must be used as a pointer.
+type CPU struct {
+	// Filesystem root, "/" if empty
+	Root string
+
+	mu   sync.Mutex
+	prev CPUStats
+}
+
+func (*CPU) Name() string {
+	return "cpu"
+}
+
+func (c *CPU) Stats() (interface{}, error) {
+	ret := CPUStats{}
+	err := readFields(join(c.Root, "proc", "stat"), func(fields []string) error {
+		if !strings.HasPrefix(fields[0], "cpu") {
+			return nil
+		}
+		if fields[0] != "cpu" {
+			ret.Cores++
+			return nil
+		}
+
+		values := make([]uint64, 8)
+		for i := range values {
+			if i+1 >= len(fields) {
+				break
+			}
+			v, err := strconv.ParseUint(fields[i+1], 10, 64)
+			if err != nil {
+				return fmt.Errorf("parsing /proc/stat: %w", err)
+			}
+			values[i] = v
+		}
+		ret.User, ret.Nice, ret.System, ret.Idle = values[0], values[1], values[2], values[3]
+		ret.IOWait, ret.IRQ, ret.SoftIRQ, ret.Steal = values[4], values[5], values[6], values[7]
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	total, idle := ret.times()
+	prevTotal, prevIdle := c.prev.times()
+	// Counters going back (iowait may, as well as every counter when CPUs go
+	// offline) would wrap around, so usage is computed since boot instead
+	if total < prevTotal || idle < prevIdle {
+		prevTotal, prevIdle = 0, 0
+	}
+	if total > prevTotal {
+		ret.Usage = 1 - float64(idle-prevIdle)/float64(total-prevTotal)
+		ret.Usage = math.Max(0, math.Min(1, ret.Usage))
+	}
+	c.prev = ret
+
+	return ret, nil
+}
@@ -0,0 +1,86 @@
+// Copyright (C) 2022 OpenRFSense
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Affero General Public License as
+// published by the Free Software Foundation, either version 3 of the
+// License, or (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU Affero General Public License for more details.
+//
+// You should have received a copy of the GNU Affero General Public License
+// along with this program.  If not, see <http://www.gnu.org/licenses/>.
+
+package providers
+
+import (
+	"fmt"
+	"strings"
+)
+
+// Type FilesystemStats contains the usage of a mounted block device, in bytes.
+type FilesystemStats struct {
+	Device     string `json:"device"`
+	MountPoint string `json:"mountPoint"`
+	Type       string `json:"type"`
+	Total      uint64 `json:"total"`
+	Free       uint64 `json:"free"`
+	Available  uint64 `json:"available"`
+}
+
+// Type Disk provides usage information for every block device listed in
+// /proc/mounts. Filesystems which cannot be queried are left out, and reported
+// in the returned error along with the stats of the others.
+type Disk struct {
+	// Filesystem root, "/" if empty
+	Root string
+}
+
+func (Disk) Name() string {
+	return "disk"
+}
+
+func (d Disk) Stats() (interface{}, error) {
+	ret := []FilesystemStats{}
+	seen := map[string]bool{}
+	failed := []string{}
+	var statfsErr error
+	err := readFields(join(d.Root, "proc", "mounts"), func(fields []string) error {
+		if len(fields) < 3 || !strings.HasPrefix(fields[0], "/dev/") || seen[fields[0]] {
+			return nil
+		}
+		seen[fields[0]] = true
+
+		fs := FilesystemStats{
+			Device:     fields[0],
+			MountPoint: unescapeMount(fields[1]),
+			Type:       fields[2],
+		}
+		var err error
+		fs.Total, fs.Free, fs.Available, err = statfs(join(d.Root, fs.MountPoint))
+		if err != nil {
+			failed = append(failed, fs.MountPoint)
+			if statfsErr == nil {
+				statfsErr = err
+			}
+			return nil
+		}
+		ret = append(ret, fs)
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	if len(failed) > 0 {
+		return ret, fmt.Errorf("reading %s: %w", strings.Join(failed, ", "), statfsErr)
+	}
+
+	return ret, nil
+}
+
+// Replaces the octal escapes used in /proc/mounts for whitespace and backslashes.
+func unescapeMount(s string) string {
+	return strings.NewReplacer(`\040`, " ", `\011`, "\t", `\012`, "\n", `\134`, `\`).Replace(s)
+}
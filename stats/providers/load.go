@@ -0,0 +1,80 @@
+// Copyright (C) 2022 OpenRFSense
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Affero General Public License as
+// published by the Free Software Foundation, either version 3 of the
+// License, or (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU Affero General Public License for more details.
+//
+// You should have received a copy of the GNU Affero General Public License
+// along with this program.  If not, see <http://www.gnu.org/licenses/>.
+
+package providers
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// Type LoadStats contains the system load averages and process counts, as
+// reported by /proc/loadavg.
+type LoadStats struct {
+	Load1  float64 `json:"load1"`
+	Load5  float64 `json:"load5"`
+	Load15 float64 `json:"load15"`
+
+	// Number of currently runnable scheduling entities
+	Running int `json:"running"`
+
+	// Number of scheduling entities which currently exist
+	Total int `json:"total"`
+}
+
+// Type Load provides load averages from /proc/loadavg.
+type Load struct {
+	// Filesystem root, "/" if empty
+	Root string
+}
+
+func (Load) Name() string {
+	return "load"
+}
+
+func (l Load) Stats() (interface{}, error) {
+	raw, err := readString(join(l.Root, "proc", "loadavg"))
+	if err != nil {
+		return nil, err
+	}
+
+	fields := strings.Fields(raw)
+	if len(fields) < 4 {
+		return nil, fmt.Errorf("parsing /proc/loadavg: unexpected format %q", raw)
+	}
+
+	ret := LoadStats{}
+	loads := []*float64{&ret.Load1, &ret.Load5, &ret.Load15}
+	for i, ptr := range loads {
+		*ptr, err = strconv.ParseFloat(fields[i], 64)
+		if err != nil {
+			return nil, fmt.Errorf("parsing /proc/loadavg: %w", err)
+		}
+	}
+
+	running, total, found := strings.Cut(fields[3], "/")
+	if !found {
+		return nil, fmt.Errorf("parsing /proc/loadavg: unexpected format %q", raw)
+	}
+	if ret.Running, err = strconv.Atoi(running); err != nil {
+		return nil, fmt.Errorf("parsing /proc/loadavg: %w", err)
+	}
+	if ret.Total, err = strconv.Atoi(total); err != nil {
+		return nil, fmt.Errorf("parsing /proc/loadavg: %w", err)
+	}
+
+	return ret, nil
+}
@@ -0,0 +1,78 @@
+// Copyright (C) 2022 OpenRFSense
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Affero General Public License as
+// published by the Free Software Foundation, either version 3 of the
+// License, or (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU Affero General Public License for more details.
+//
+// You should have received a copy of the GNU Affero General Public License
+// along with this program.  If not, see <http://www.gnu.org/licenses/>.
+
+package providers
+
+import (
+	"fmt"
+	"strconv"
+)
+
+// Type MemoryStats contains memory and swap usage in bytes, as reported by
+// /proc/meminfo.
+type MemoryStats struct {
+	Total     uint64 `json:"total"`
+	Free      uint64 `json:"free"`
+	Available uint64 `json:"available"`
+	Buffers   uint64 `json:"buffers"`
+	Cached    uint64 `json:"cached"`
+	SwapTotal uint64 `json:"swapTotal"`
+	SwapFree  uint64 `json:"swapFree"`
+}
+
+// Type Memory provides memory usage from /proc/meminfo.
+type Memory struct {
+	// Filesystem root, "/" if empty
+	Root string
+}
+
+func (Memory) Name() string {
+	return "memory"
+}
+
+func (m Memory) Stats() (interface{}, error) {
+	ret := MemoryStats{}
+	dest := map[string]*uint64{
+		"MemTotal:":     &ret.Total,
+		"MemFree:":      &ret.Free,
+		"MemAvailable:": &ret.Available,
+		"Buffers:":      &ret.Buffers,
+		"Cached:":       &ret.Cached,
+		"SwapTotal:":    &ret.SwapTotal,
+		"SwapFree:":     &ret.SwapFree,
+	}
+
+	err := readFields(join(m.Root, "proc", "meminfo"), func(fields []string) error {
+		ptr, ok := dest[fields[0]]
+		if !ok || len(fields) < 2 {
+			return nil
+		}
+		v, err := strconv.ParseUint(fields[1], 10, 64)
+		if err != nil {
+			return fmt.Errorf("parsing /proc/meminfo: %w", err)
+		}
+		// Values are in kB unless no unit is given
+		if len(fields) > 2 && fields[2] == "kB" {
+			v *= 1024
+		}
+		*ptr = v
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return ret, nil
+}
@@ -0,0 +1,84 @@
+// Copyright (C) 2022 OpenRFSense
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Affero General Public License as
+// published by the Free Software Foundation, either version 3 of the
+// License, or (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU Affero General Public License for more details.
+//
+// You should have received a copy of the GNU Affero General Public License
+// along with this program.  If not, see <http://www.gnu.org/licenses/>.
+
+package providers
+
+import (
+	"os"
+	"path/filepath"
+)
+
+// Type InterfaceStats contains the state and traffic counters of a network
+// interface, as reported by /sys/class/net.
+type InterfaceStats struct {
+	Name      string `json:"name"`
+	State     string `json:"state"`
+	Address   string `json:"address"`
+	RxBytes   uint64 `json:"rxBytes"`
+	TxBytes   uint64 `json:"txBytes"`
+	RxPackets uint64 `json:"rxPackets"`
+	TxPackets uint64 `json:"txPackets"`
+	RxErrors  uint64 `json:"rxErrors"`
+	TxErrors  uint64 `json:"txErrors"`
+}
+
+// Type Network provides information about every network interface in
+// /sys/class/net, except loopback.
+type Network struct {
+	// Filesystem root, "/" if empty
+	Root string
+}
+
+func (Network) Name() string {
+	return "network"
+}
+
+func (n Network) Stats() (interface{}, error) {
+	base := join(n.Root, "sys", "class", "net")
+	entries, err := os.ReadDir(base)
+	if err != nil {
+		return nil, err
+	}
+
+	ret := []InterfaceStats{}
+	for _, entry := range entries {
+		if entry.Name() == "lo" {
+			continue
+		}
+		dir := filepath.Join(base, entry.Name())
+
+		iface := InterfaceStats{Name: entry.Name()}
+		iface.State, _ = readString(filepath.Join(dir, "operstate"))
+		iface.Address, _ = readString(filepath.Join(dir, "address"))
+
+		counters := map[string]*uint64{
+			"rx_bytes":   &iface.RxBytes,
+			"tx_bytes":   &iface.TxBytes,
+			"rx_packets": &iface.RxPackets,
+			"tx_packets": &iface.TxPackets,
+			"rx_errors":  &iface.RxErrors,
+			"tx_errors":  &iface.TxErrors,
+		}
+		for name, ptr := range counters {
+			if *ptr, err = readUint(filepath.Join(dir, "statistics", name)); err != nil {
+				return nil, err
+			}
+		}
+
+		ret = append(ret, iface)
+	}
+
+	return ret, nil
+}
@@ -0,0 +1,98 @@
+// Copyright (C) 2022 OpenRFSense
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Affero General Public License as
+// published by the Free Software Foundation, either version 3 of the
+// License, or (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU Affero General Public License for more details.
+//
+// You should have received a copy of the GNU Affero General Public License
+// along with this program.  If not, see <http://www.gnu.org/licenses/>.
+
+// Package providers implements stats.Provider for common Linux system information
+// (CPU, memory, load, disks, temperatures and network interfaces) by reading
+// /proc and /sys. Every provider has a Root field which, when not empty, is used
+// as the filesystem root instead of "/", so that a fake tree can be used in tests.
+package providers
+
+import (
+	"bufio"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	"github.com/openrfsense/common/stats"
+)
+
+var (
+	_ stats.Provider = &CPU{}
+	_ stats.Provider = Memory{}
+	_ stats.Provider = Load{}
+	_ stats.Provider = Disk{}
+	_ stats.Provider = Temperature{}
+	_ stats.Provider = Network{}
+)
+
+// Registers the stats types of all providers, so that stats.Stats decodes them
+// into their concrete type.
+func init() {
+	stats.RegisterType((&CPU{}).Name(), CPUStats{})
+	stats.RegisterType(Memory{}.Name(), MemoryStats{})
+	stats.RegisterType(Load{}.Name(), LoadStats{})
+	stats.RegisterType(Disk{}.Name(), []FilesystemStats{})
+	stats.RegisterType(Temperature{}.Name(), []ThermalZoneStats{})
+	stats.RegisterType(Network{}.Name(), []InterfaceStats{})
+}
+
+// Joins the given path to root, using "/" if root is empty.
+func join(root string, path ...string) string {
+	if root == "" {
+		root = "/"
+	}
+	return filepath.Join(append([]string{root}, path...)...)
+}
+
+// Reads a file and returns its content without surrounding whitespace.
+func readString(path string) (string, error) {
+	raw, err := os.ReadFile(path)
+	if err != nil {
+		return "", err
+	}
+	return strings.TrimSpace(string(raw)), nil
+}
+
+// Reads a file containing a single unsigned integer.
+func readUint(path string) (uint64, error) {
+	s, err := readString(path)
+	if err != nil {
+		return 0, err
+	}
+	return strconv.ParseUint(s, 10, 64)
+}
+
+// Reads a file line by line, calling fn with the whitespace-separated fields of
+// each non-empty line.
+func readFields(path string, fn func(fields []string) error) error {
+	f, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		fields := strings.Fields(scanner.Text())
+		if len(fields) == 0 {
+			continue
+		}
+		if err := fn(fields); err != nil {
+			return err
+		}
+	}
+	return scanner.Err()
+}
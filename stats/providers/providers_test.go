@@ -0,0 +1,230 @@
+// Copyright (C) 2022 OpenRFSense
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Affero General Public License as
+// published by the Free Software Foundation, either version 3 of the
+// License, or (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU Affero General Public License for more details.
+//
+// You should have received a copy of the GNU Affero General Public License
+// along with this program.  If not, see <http://www.gnu.org/licenses/>.
+
+package providers
+
+import (
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/openrfsense/common/stats"
+)
+
+const testRoot = "testdata/root"
+
+func TestProviders(t *testing.T) {
+	t.Run("cpu", func(t *testing.T) {
+		cpu := &CPU{Root: testRoot}
+		got, err := cpu.Stats()
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		exp := CPUStats{
+			Cores:   4,
+			User:    4705,
+			Nice:    356,
+			System:  584,
+			Idle:    3699,
+			IOWait:  23,
+			SoftIRQ: 2,
+		}
+		exp.Usage = 1 - float64(3699+23)/float64(4705+356+584+3699+23+2)
+		if !reflect.DeepEqual(got, exp) {
+			t.Fatalf("expected %+v, got %+v", exp, got)
+		}
+
+		// Nothing changed since the last call
+		got, err = cpu.Stats()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if usage := got.(CPUStats).Usage; usage != 0 {
+			t.Fatalf("expected usage to be 0 on unchanged counters, got %v", usage)
+		}
+
+		t.Run("counters going back", func(t *testing.T) {
+			root := t.TempDir()
+			cpu := &CPU{Root: root}
+			// Idle time goes back from 500 to 400 with the second read
+			for _, read := range []struct {
+				stat string
+				exp  float64
+			}{
+				{"cpu  250 0 250 400 100 0 0 0\n", 0.5},
+				{"cpu  600 0 600 350 50 0 0 0\n", 0.75},
+			} {
+				writeFile(t, root, "proc/stat", read.stat)
+				got, err := cpu.Stats()
+				if err != nil {
+					t.Fatal(err)
+				}
+				if usage := got.(CPUStats).Usage; usage != read.exp {
+					t.Fatalf("expected usage %v since boot, got %v", read.exp, usage)
+				}
+			}
+		})
+	})
+
+	t.Run("memory", func(t *testing.T) {
+		got, err := Memory{Root: testRoot}.Stats()
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		exp := MemoryStats{
+			Total:     3884376 * 1024,
+			Free:      2577164 * 1024,
+			Available: 3262096 * 1024,
+			Buffers:   40064 * 1024,
+			Cached:    738584 * 1024,
+			SwapTotal: 102396 * 1024,
+			SwapFree:  102396 * 1024,
+		}
+		if !reflect.DeepEqual(got, exp) {
+			t.Fatalf("expected %+v, got %+v", exp, got)
+		}
+	})
+
+	t.Run("load", func(t *testing.T) {
+		got, err := Load{Root: testRoot}.Stats()
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		exp := LoadStats{Load1: 0.52, Load5: 0.58, Load15: 0.59, Running: 2, Total: 312}
+		if !reflect.DeepEqual(got, exp) {
+			t.Fatalf("expected %+v, got %+v", exp, got)
+		}
+	})
+
+	t.Run("disk", func(t *testing.T) {
+		got, err := Disk{Root: testRoot}.Stats()
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		fs := got.([]FilesystemStats)
+		if len(fs) != 2 {
+			t.Fatalf("expected 2 filesystems, got %+v", fs)
+		}
+		if fs[0].Device != "/dev/mmcblk0p2" || fs[0].MountPoint != "/" || fs[0].Type != "ext4" {
+			t.Fatalf("unexpected root filesystem %+v", fs[0])
+		}
+		if fs[1].MountPoint != "/mnt/sd card" {
+			t.Fatalf("expected mount point to be unescaped, got '%s'", fs[1].MountPoint)
+		}
+		if fs[0].Total == 0 || fs[0].Available > fs[0].Total {
+			t.Fatalf("unexpected filesystem usage %+v", fs[0])
+		}
+
+		t.Run("unreadable mount", func(t *testing.T) {
+			root := t.TempDir()
+			writeFile(t, root, "proc/mounts", "/dev/sda1 / ext4 rw 0 0\n/dev/sdb1 /missing ext4 rw 0 0\n")
+
+			got, err := Disk{Root: root}.Stats()
+			if err == nil || !strings.Contains(err.Error(), "/missing") {
+				t.Fatalf("expected an error for /missing, got %v", err)
+			}
+			if fs := got.([]FilesystemStats); len(fs) != 1 || fs[0].Device != "/dev/sda1" {
+				t.Fatalf("expected the readable filesystem only, got %+v", fs)
+			}
+		})
+	})
+
+	t.Run("temperature", func(t *testing.T) {
+		got, err := Temperature{Root: testRoot}.Stats()
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		exp := []ThermalZoneStats{
+			{Zone: "thermal_zone0", Type: "cpu-thermal", Celsius: 48.312},
+			{Zone: "thermal_zone1", Type: "", Celsius: -5},
+		}
+		if !reflect.DeepEqual(got, exp) {
+			t.Fatalf("expected %+v, got %+v", exp, got)
+		}
+	})
+
+	t.Run("network", func(t *testing.T) {
+		got, err := Network{Root: testRoot}.Stats()
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		exp := []InterfaceStats{
+			{Name: "eth0", State: "up", Address: "dc:a6:32:01:02:03", RxBytes: 123456, TxBytes: 654321, RxErrors: 3},
+			{Name: "wlan0", State: "down", Address: "dc:a6:32:01:02:04"},
+		}
+		if !reflect.DeepEqual(got, exp) {
+			t.Fatalf("expected %+v, got %+v", exp, got)
+		}
+	})
+
+	t.Run("missing files", func(t *testing.T) {
+		_, err := Load{Root: "testdata/missing"}.Stats()
+		if err == nil {
+			t.Fatal("err should not be nil")
+		}
+	})
+
+	t.Run("all providers", func(t *testing.T) {
+		s := stats.Stats{}
+		err := s.Provide(
+			&CPU{Root: testRoot},
+			Memory{Root: testRoot},
+			Load{Root: testRoot},
+			Disk{Root: testRoot},
+			Temperature{Root: testRoot},
+			Network{Root: testRoot},
+		)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		raw, err := json.Marshal(&s)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		out := stats.Stats{}
+		err = json.Unmarshal(raw, &out)
+		if err != nil {
+			t.Fatal(err)
+		}
+		for name, v := range s.Providers {
+			if !reflect.DeepEqual(out.Providers[name], v) {
+				t.Fatalf("expected provider %s to be decoded as %#v, got %#v", name, v, out.Providers[name])
+			}
+		}
+	})
+}
+
+// Writes content to path relative to root, creating its parent directories.
+func writeFile(t *testing.T, root string, path string, content string) {
+	t.Helper()
+	path = filepath.Join(root, path)
+	if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(path, []byte(content), 0o644); err != nil {
+		t.Fatal(err)
+	}
+}
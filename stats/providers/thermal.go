@@ -0,0 +1,77 @@
+// Copyright (C) 2022 OpenRFSense
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Affero General Public License as
+// published by the Free Software Foundation, either version 3 of the
+// License, or (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU Affero General Public License for more details.
+//
+// You should have received a copy of the GNU Affero General Public License
+// along with this program.  If not, see <http://www.gnu.org/licenses/>.
+
+package providers
+
+import (
+	"fmt"
+	"path/filepath"
+	"strconv"
+)
+
+// Type ThermalZoneStats contains the temperature of a single thermal zone, as
+// reported by /sys/class/thermal.
+type ThermalZoneStats struct {
+	// Name of the zone, such as "thermal_zone0"
+	Zone string `json:"zone"`
+
+	// Type of the zone, such as "cpu-thermal"
+	Type string `json:"type"`
+
+	// Temperature in degrees Celsius
+	Celsius float64 `json:"celsius"`
+}
+
+// Type Temperature provides the temperature of every thermal zone in
+// /sys/class/thermal.
+type Temperature struct {
+	// Filesystem root, "/" if empty
+	Root string
+}
+
+func (Temperature) Name() string {
+	return "temperature"
+}
+
+func (t Temperature) Stats() (interface{}, error) {
+	zones, err := filepath.Glob(join(t.Root, "sys", "class", "thermal", "thermal_zone*"))
+	if err != nil {
+		return nil, err
+	}
+
+	ret := []ThermalZoneStats{}
+	for _, zone := range zones {
+		milli, err := readString(filepath.Join(zone, "temp"))
+		if err != nil {
+			return nil, err
+		}
+		// Temperature may be negative, so it is not read with readUint
+		v, err := strconv.ParseInt(milli, 10, 64)
+		if err != nil {
+			return nil, fmt.Errorf("parsing %s: %w", zone, err)
+		}
+
+		// The type file is missing on some platforms
+		typ, _ := readString(filepath.Join(zone, "type"))
+
+		ret = append(ret, ThermalZoneStats{
+			Zone:    filepath.Base(zone),
+			Type:    typ,
+			Celsius: float64(v) / 1000,
+		})
+	}
+
+	return ret, nil
+}
@@ -0,0 +1,313 @@
+// Copyright (C) 2022 OpenRFSense
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Affero General Public License as
+// published by the Free Software Foundation, either version 3 of the
+// License, or (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU Affero General Public License for more details.
+//
+// You should have received a copy of the GNU Affero General Public License
+// along with this program.  If not, see <http://www.gnu.org/licenses/>.
+
+package stats
+
+import (
+	"math"
+	"sort"
+	"sync"
+	"sync/atomic"
+)
+
+var (
+	_ Provider        = &Registry{}
+	_ MetricsProvider = &Registry{}
+)
+
+// Type AtomicCounter is a monotonically increasing value, safe for concurrent
+// use without locking.
+type AtomicCounter struct {
+	value atomic.Uint64
+}
+
+// Increments the counter by one.
+func (c *AtomicCounter) Inc() {
+	c.value.Add(1)
+}
+
+// Increments the counter by n.
+func (c *AtomicCounter) Add(n uint64) {
+	c.value.Add(n)
+}
+
+// Returns the current value of the counter.
+func (c *AtomicCounter) Value() uint64 {
+	return c.value.Load()
+}
+
+// Type AtomicGauge is a value which can go up and down, safe for concurrent
+// use without locking.
+type AtomicGauge struct {
+	bits atomic.Uint64
+}
+
+// Sets the gauge to v.
+func (g *AtomicGauge) Set(v float64) {
+	g.bits.Store(math.Float64bits(v))
+}
+
+// Adds delta (which may be negative) to the gauge.
+func (g *AtomicGauge) Add(delta float64) {
+	addFloat(&g.bits, delta)
+}
+
+// Returns the current value of the gauge.
+func (g *AtomicGauge) Value() float64 {
+	return math.Float64frombits(g.bits.Load())
+}
+
+// Type AtomicHistogram counts observed values in buckets, safe for concurrent
+// use without locking. Buckets are defined by their inclusive upper bound, an
+// implicit +Inf bucket catches everything else.
+type AtomicHistogram struct {
+	bounds []float64
+	counts []atomic.Uint64
+	count  atomic.Uint64
+	sum    atomic.Uint64
+}
+
+// Creates a histogram with the given bucket upper bounds, which are sorted and
+// deduplicated.
+func newHistogram(bounds []float64) *AtomicHistogram {
+	sorted := append([]float64(nil), bounds...)
+	sort.Float64s(sorted)
+	unique := sorted[:0]
+	for i, b := range sorted {
+		if i == 0 || b != sorted[i-1] {
+			unique = append(unique, b)
+		}
+	}
+
+	return &AtomicHistogram{
+		bounds: unique,
+		counts: make([]atomic.Uint64, len(unique)+1),
+	}
+}
+
+// Records a single value.
+func (h *AtomicHistogram) Observe(v float64) {
+	h.counts[sort.SearchFloat64s(h.bounds, v)].Add(1)
+	h.count.Add(1)
+	addFloat(&h.sum, v)
+}
+
+// Type Bucket is a single histogram bucket. Counts are cumulative, as in Prometheus.
+type Bucket struct {
+	UpperBound float64 `json:"le"`
+	Count      uint64  `json:"count"`
+}
+
+// Type HistogramStats is a snapshot of a Histogram.
+type HistogramStats struct {
+	Count uint64  `json:"count"`
+	Sum   float64 `json:"sum"`
+
+	// Finite buckets only, the +Inf bucket is Count
+	Buckets []Bucket `json:"buckets"`
+}
+
+// Returns a snapshot of the histogram. Since it is taken without locking, the
+// total count may be slightly ahead of the buckets under concurrent use.
+func (h *AtomicHistogram) Value() HistogramStats {
+	ret := HistogramStats{
+		Buckets: make([]Bucket, len(h.bounds)),
+	}
+
+	cumulative := uint64(0)
+	for i, b := range h.bounds {
+		cumulative += h.counts[i].Load()
+		ret.Buckets[i] = Bucket{UpperBound: b, Count: cumulative}
+	}
+	ret.Count = h.count.Load()
+	ret.Sum = math.Float64frombits(h.sum.Load())
+
+	return ret
+}
+
+// Atomically adds delta to the float64 stored as bits in u.
+func addFloat(u *atomic.Uint64, delta float64) {
+	for {
+		old := u.Load()
+		next := math.Float64bits(math.Float64frombits(old) + delta)
+		if u.CompareAndSwap(old, next) {
+			return
+		}
+	}
+}
+
+// Type RegistryStats is the value returned by Registry.Stats.
+type RegistryStats struct {
+	Counters   map[string]uint64         `json:"counters,omitempty"`
+	Gauges     map[string]float64        `json:"gauges,omitempty"`
+	Histograms map[string]HistogramStats `json:"histograms,omitempty"`
+}
+
+// Type Registry holds named counters, gauges and histograms and is itself a
+// Provider, so the metrics appear under Stats.Providers[name]. Looking up a metric
+// takes a lock, so the returned pointers should be kept by callers on hot paths.
+// New instances are to be created with stats.NewRegistry(). To decode the
+// stats on the backend, register RegistryStats with RegisterType.
+type Registry struct {
+	name string
+
+	mu         sync.RWMutex
+	counters   map[string]*AtomicCounter
+	gauges     map[string]*AtomicGauge
+	histograms map[string]*AtomicHistogram
+}
+
+// Creates an empty Registry which provides its stats under the given name.
+func NewRegistry(name string) *Registry {
+	return &Registry{
+		name:       name,
+		counters:   make(map[string]*AtomicCounter),
+		gauges:     make(map[string]*AtomicGauge),
+		histograms: make(map[string]*AtomicHistogram),
+	}
+}
+
+// Returns the counter with the given name, creating it if needed.
+func (r *Registry) Counter(name string) *AtomicCounter {
+	r.mu.RLock()
+	c, ok := r.counters[name]
+	r.mu.RUnlock()
+	if ok {
+		return c
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if c, ok = r.counters[name]; !ok {
+		c = &AtomicCounter{}
+		r.counters[name] = c
+	}
+	return c
+}
+
+// Returns the gauge with the given name, creating it if needed.
+func (r *Registry) Gauge(name string) *AtomicGauge {
+	r.mu.RLock()
+	g, ok := r.gauges[name]
+	r.mu.RUnlock()
+	if ok {
+		return g
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if g, ok = r.gauges[name]; !ok {
+		g = &AtomicGauge{}
+		r.gauges[name] = g
+	}
+	return g
+}
+
+// Returns the histogram with the given name, creating it with the given bucket
+// upper bounds if needed. Bounds are ignored if the histogram already exists.
+func (r *Registry) Histogram(name string, bounds ...float64) *AtomicHistogram {
+	r.mu.RLock()
+	h, ok := r.histograms[name]
+	r.mu.RUnlock()
+	if ok {
+		return h
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if h, ok = r.histograms[name]; !ok {
+		h = newHistogram(bounds)
+		r.histograms[name] = h
+	}
+	return h
+}
+
+func (r *Registry) Name() string {
+	return r.name
+}
+
+// Returns a RegistryStats with the current value of every metric.
+func (r *Registry) Stats() (interface{}, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	ret := RegistryStats{}
+	if len(r.counters) > 0 {
+		ret.Counters = make(map[string]uint64, len(r.counters))
+		for name, c := range r.counters {
+			ret.Counters[name] = c.Value()
+		}
+	}
+	if len(r.gauges) > 0 {
+		ret.Gauges = make(map[string]float64, len(r.gauges))
+		for name, g := range r.gauges {
+			ret.Gauges[name] = g.Value()
+		}
+	}
+	if len(r.histograms) > 0 {
+		ret.Histograms = make(map[string]HistogramStats, len(r.histograms))
+		for name, h := range r.histograms {
+			ret.Histograms[name] = h.Value()
+		}
+	}
+
+	return ret, nil
+}
+
+// Exposes counters and gauges with their own type. Histograms are exposed as a
+// histogram family with the usual _bucket (with an "le" label), _sum and _count
+// samples.
+func (r *Registry) Metrics(stats interface{}) []Metric {
+	rs, ok := stats.(RegistryStats)
+	if !ok {
+		return nil
+	}
+
+	prefix := sanitizeName(snakeCase(r.name)) + "_"
+	ret := []Metric{}
+	for _, name := range sortedKeys(rs.Counters) {
+		ret = append(ret, Metric{Name: prefix + name, Type: Counter, Value: float64(rs.Counters[name])})
+	}
+	for _, name := range sortedKeys(rs.Gauges) {
+		ret = append(ret, Metric{Name: prefix + name, Value: rs.Gauges[name]})
+	}
+	for _, name := range sortedKeys(rs.Histograms) {
+		h := rs.Histograms[name]
+		for _, b := range h.Buckets {
+			ret = append(ret, Metric{
+				Name:   prefix + name + "_bucket",
+				Type:   Histogram,
+				Labels: map[string]string{"le": formatValue(b.UpperBound)},
+				Value:  float64(b.Count),
+			})
+		}
+		ret = append(ret,
+			Metric{Name: prefix + name + "_bucket", Type: Histogram, Labels: map[string]string{"le": "+Inf"}, Value: float64(h.Count)},
+			Metric{Name: prefix + name + "_sum", Type: Histogram, Value: h.Sum},
+			Metric{Name: prefix + name + "_count", Type: Histogram, Value: float64(h.Count)},
+		)
+	}
+	return ret
+}
+
+// Returns the keys of m in ascending order.
+func sortedKeys[V any](m map[string]V) []string {
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
@@ -15,10 +15,7 @@
 
 package stats
 
-import (
-	"fmt"
-	"time"
-)
+import "time"
 
 // Interface Provider describes a generic stats provider which can add more
 // information to the Stats type.
@@ -42,35 +39,57 @@ type Stats struct {
 	// The model/vendor of the system's hardware, useful for identification
 	Model string `json:"model"`
 
-	// Uptime of the system
-	Uptime time.Duration `json:"uptime"`
+	// Uptime of the system. Encoded in JSON as an ISO 8601 duration ("uptime")
+	// and as seconds ("uptimeSeconds"), see MarshalJSON
+	Uptime time.Duration `json:"-"`
+
+	// When the system booted. Left out of the JSON encoding if not set
+	BootTime time.Time `json:"bootTime"`
 
 	// Extra, more in-depth information about the system as dynamically returned by providers.
 	Providers map[string]interface{} `json:"providers,omitempty"`
+
+	// Names of the providers which did not return before their timeout, see ProvideContext.
+	TimedOut []string `json:"timedOut,omitempty"`
+
+	// Error messages of the providers which failed, by provider name.
+	Errors map[string]string `json:"errors,omitempty"`
 }
 
 // Executes the given providers and stores the returned stats in Stats.Providers.
+// If any provider fails, the returned error is a ProviderErrors and the failures
+// are also recorded in Stats.Errors.
 func (s *Stats) Provide(providers ...Provider) error {
 	if len(providers) == 0 {
 		return nil
 	}
 
+	var errs ProviderErrors
+	for _, p := range providers {
+		stats, err := p.Stats()
+		errs = s.record(p.Name(), stats, err, errs)
+	}
+
+	return errs.orNil()
+}
+
+// Stores the outcome of a single provider. If err is not nil, it is recorded in
+// Stats.Errors and appended to errs, otherwise any previous error is cleared.
+func (s *Stats) record(name string, stats interface{}, err error, errs ProviderErrors) ProviderErrors {
 	if s.Providers == nil {
 		s.Providers = make(map[string]interface{})
 	}
+	s.Providers[name] = stats
 
-	var errBundle error
-	for _, p := range providers {
-		stats, err := p.Stats()
-		if err != nil {
-			if errBundle == nil {
-				errBundle = err
-			} else {
-				errBundle = fmt.Errorf("%s: %w", err.Error(), errBundle)
-			}
-		}
-		s.Providers[p.Name()] = stats
+	if err == nil {
+		delete(s.Errors, name)
+		return errs
+	}
+
+	if s.Errors == nil {
+		s.Errors = make(map[string]string)
 	}
+	s.Errors[name] = err.Error()
 
-	return errBundle
+	return append(errs, &ProviderError{Provider: name, Err: err})
 }
@@ -16,10 +16,23 @@
 package stats
 
 import (
+	"bytes"
+	"context"
 	"encoding/json"
 	"errors"
+	"math"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"sync"
+	"sync/atomic"
 	"testing"
 	"time"
+
+	"github.com/openrfsense/common/id"
 )
 
 type statsFs struct {
@@ -126,3 +139,1126 @@ func TestProviders(t *testing.T) {
 		}
 	})
 }
+
+type slowProvider struct {
+	name    string
+	delay   time.Duration
+	timeout time.Duration
+}
+
+func (sp slowProvider) Stats() (interface{}, error) {
+	time.Sleep(sp.delay)
+	return sp.delay.String(), nil
+}
+
+func (sp slowProvider) Name() string {
+	return sp.name
+}
+
+func (sp slowProvider) Timeout() time.Duration {
+	return sp.timeout
+}
+
+type ctxProvider struct{}
+
+func (ctxProvider) Stats() (interface{}, error) {
+	return ctxProvider{}.StatsContext(context.Background())
+}
+
+func (ctxProvider) StatsContext(ctx context.Context) (interface{}, error) {
+	<-ctx.Done()
+	return nil, ctx.Err()
+}
+
+func (ctxProvider) Name() string {
+	return "ctx"
+}
+
+func (ctxProvider) Timeout() time.Duration {
+	return 10 * time.Millisecond
+}
+
+func TestProvideContext(t *testing.T) {
+	t.Run("parallel execution", func(t *testing.T) {
+		s := Stats{}
+
+		start := time.Now()
+		err := s.ProvideContext(context.Background(),
+			slowProvider{name: "a", delay: 100 * time.Millisecond, timeout: time.Second},
+			slowProvider{name: "b", delay: 100 * time.Millisecond, timeout: time.Second},
+			staticDataProvider{Data: "data"},
+		)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if took := time.Since(start); took >= 200*time.Millisecond {
+			t.Fatalf("providers did not run in parallel, took %v", took)
+		}
+		if len(s.TimedOut) != 0 {
+			t.Fatalf("expected no timed out providers, got %v", s.TimedOut)
+		}
+		if got := s.Providers["a"]; got != "100ms" {
+			t.Fatalf("expected provider a to be '100ms', got '%v'", got)
+		}
+		if got := s.Providers["staticData"]; got != "data" {
+			t.Fatalf("expected provider staticData to be 'data', got '%v'", got)
+		}
+	})
+
+	t.Run("per-provider timeout", func(t *testing.T) {
+		s := Stats{}
+
+		err := s.ProvideContext(context.Background(),
+			slowProvider{name: "hung", delay: time.Second, timeout: 10 * time.Millisecond},
+			slowProvider{name: "fast", delay: 0, timeout: time.Second},
+			ctxProvider{},
+		)
+		if !errors.Is(err, context.DeadlineExceeded) {
+			t.Fatalf("expected deadline exceeded error, got %v", err)
+		}
+
+		if len(s.TimedOut) != 2 || s.TimedOut[0] != "hung" || s.TimedOut[1] != "ctx" {
+			t.Fatalf("expected [hung ctx] to time out, got %v", s.TimedOut)
+		}
+		if got := s.Providers["fast"]; got != "0s" {
+			t.Fatalf("expected provider fast to be '0s', got '%v'", got)
+		}
+		if got, ok := s.Providers["hung"]; !ok || got != nil {
+			t.Fatalf("expected provider hung to be stored as nil, got '%v'", got)
+		}
+	})
+
+	t.Run("repeated calls", func(t *testing.T) {
+		s := Stats{}
+		hung := slowProvider{name: "slow", delay: time.Second, timeout: 10 * time.Millisecond}
+		for i := 0; i < 3; i++ {
+			_ = s.ProvideContext(context.Background(), hung)
+		}
+		if len(s.TimedOut) != 1 || s.TimedOut[0] != "slow" {
+			t.Fatalf("expected [slow] to time out, got %v", s.TimedOut)
+		}
+
+		fast := slowProvider{name: "slow", delay: 0, timeout: time.Second}
+		if err := s.ProvideContext(context.Background(), fast); err != nil {
+			t.Fatal(err)
+		}
+		if s.TimedOut != nil {
+			t.Fatalf("expected no timed out providers, got %v", s.TimedOut)
+		}
+		if _, ok := s.Errors["slow"]; ok {
+			t.Fatalf("expected the error of slow to be cleared, got %v", s.Errors)
+		}
+	})
+}
+
+var errSDR = errors.New("usb device busy")
+
+type sdrProvider struct{}
+
+func (sdrProvider) Stats() (interface{}, error) {
+	return nil, errSDR
+}
+
+func (sdrProvider) Name() string {
+	return "sdr"
+}
+
+func TestProviderErrors(t *testing.T) {
+	s := Stats{}
+
+	err := s.Provide(fsProvider{}, errProvider{}, sdrProvider{})
+	if !errors.Is(err, errSDR) {
+		t.Fatalf("expected errors.Is to find the sdr error in '%v'", err)
+	}
+
+	var perr *ProviderError
+	if !errors.As(err, &perr) || perr.Provider != "err" {
+		t.Fatalf("expected errors.As to find the err provider error, got %v", perr)
+	}
+
+	var errs ProviderErrors
+	if !errors.As(err, &errs) || len(errs) != 2 {
+		t.Fatalf("expected 2 provider errors, got %v", errs)
+	}
+	if errs[1].Provider != "sdr" {
+		t.Fatalf("expected second error to come from 'sdr', got '%s'", errs[1].Provider)
+	}
+
+	raw, err := json.Marshal(&s)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	out := Stats{}
+	err = json.Unmarshal(raw, &out)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(out.Errors) != 2 || out.Errors["sdr"] != errSDR.Error() || out.Errors["err"] != "error" {
+		t.Fatalf("unexpected errors after JSON round-trip: %v", out.Errors)
+	}
+	if _, ok := out.Errors["fs"]; ok {
+		t.Fatal("fs provider should not have an error")
+	}
+
+	// A later successful run clears the error
+	err = s.Provide(slowProvider{name: "sdr"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(s.Errors) != 1 || s.Errors["err"] == "" {
+		t.Fatalf("expected only the err provider error to be kept, got %v", s.Errors)
+	}
+}
+
+type countingProvider struct {
+	name  string
+	count *int32
+}
+
+func (cp countingProvider) Stats() (interface{}, error) {
+	return atomic.AddInt32(cp.count, 1), nil
+}
+
+func (cp countingProvider) Name() string {
+	return cp.name
+}
+
+func TestCollector(t *testing.T) {
+	fast, slow := int32(0), int32(0)
+	c := NewCollector().
+		WithStats(Stats{ID: "id"}).
+		WithHistory(3).
+		WithProvider(countingProvider{name: "fast", count: &fast}, 10*time.Millisecond).
+		WithProvider(countingProvider{name: "slow", count: &slow}, time.Hour)
+
+	if _, ok := c.Latest(); ok {
+		t.Fatal("expected no snapshot before Run")
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 100*time.Millisecond)
+	defer cancel()
+
+	done := make(chan error)
+	go func() {
+		done <- c.Run(ctx)
+	}()
+
+	// Readers must be safe to use while collecting
+	for ctx.Err() == nil {
+		c.Latest()
+		c.History()
+		time.Sleep(time.Millisecond)
+	}
+	if err := <-done; !errors.Is(err, context.DeadlineExceeded) {
+		t.Fatalf("expected deadline exceeded, got %v", err)
+	}
+
+	if n := atomic.LoadInt32(&slow); n != 1 {
+		t.Fatalf("expected slow provider to run once, ran %d times", n)
+	}
+	if n := atomic.LoadInt32(&fast); n < 3 {
+		t.Fatalf("expected fast provider to run at least 3 times, ran %d times", n)
+	}
+
+	history := c.History()
+	if len(history) != 3 {
+		t.Fatalf("expected 3 snapshots, got %d", len(history))
+	}
+	for i := 1; i < len(history); i++ {
+		if history[i].Time.Before(history[i-1].Time) {
+			t.Fatal("expected history to be sorted oldest first")
+		}
+		prev, cur := history[i-1].Stats.Providers["fast"].(int32), history[i].Stats.Providers["fast"].(int32)
+		if cur != prev+1 {
+			t.Fatalf("expected consecutive snapshots, got %d after %d", cur, prev)
+		}
+	}
+
+	latest, ok := c.Latest()
+	if !ok {
+		t.Fatal("expected a snapshot after Run")
+	}
+	if latest.Stats.ID != "id" {
+		t.Fatalf("expected base stats to be kept, got ID '%s'", latest.Stats.ID)
+	}
+	if latest.Stats.Providers["slow"] != int32(1) {
+		t.Fatalf("expected slow provider value to be kept, got %v", latest.Stats.Providers["slow"])
+	}
+	if latest.Stats.Providers["fast"] != history[2].Stats.Providers["fast"] {
+		t.Fatalf("expected latest snapshot to be the last in history, got %v", latest.Stats.Providers["fast"])
+	}
+}
+
+func TestRegisterType(t *testing.T) {
+	RegisterType("fs", []statsFs{})
+
+	s := Stats{ID: "id"}
+	err := s.Provide(fsProvider{}, staticDataProvider{Data: "data"}, errProvider{})
+	if err == nil {
+		t.Fatal("err should not be nil")
+	}
+
+	raw, err := json.Marshal(&s)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	out := Stats{}
+	err = json.Unmarshal(raw, &out)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if out.ID != "id" {
+		t.Fatalf("expected ID 'id', got '%s'", out.ID)
+	}
+
+	fs, ok := out.Providers["fs"].([]statsFs)
+	if !ok || len(fs) != 1 || fs[0].Device != "device" {
+		t.Fatalf("expected fs provider to be decoded as []statsFs, got %#v", out.Providers["fs"])
+	}
+
+	static, ok := out.Providers["staticData"].(json.RawMessage)
+	if !ok || string(static) != `"data"` {
+		t.Fatalf("expected unknown provider to be kept as json.RawMessage, got %#v", out.Providers["staticData"])
+	}
+
+	if got, ok := out.Providers["err"]; !ok || got != nil {
+		t.Fatalf("expected err provider to be nil, got %#v", got)
+	}
+
+	// Unknown providers are re-encoded unchanged
+	again, err := json.Marshal(&out)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(again) != string(raw) {
+		t.Fatalf("expected '%s' after re-encoding, got '%s'", raw, again)
+	}
+
+	t.Run("mismatched type", func(t *testing.T) {
+		err := json.Unmarshal([]byte(`{"providers":{"fs":"not a list"}}`), &Stats{})
+		if err == nil {
+			t.Fatal("err should not be nil")
+		}
+	})
+}
+
+type sdrMetricsProvider struct{}
+
+type sdrStats struct {
+	Samples uint64
+	Gain    float64
+}
+
+func (sdrMetricsProvider) Stats() (interface{}, error) {
+	return sdrStats{Samples: 1024, Gain: 20.7}, nil
+}
+
+func (sdrMetricsProvider) Name() string {
+	return "sdr"
+}
+
+func (sdrMetricsProvider) Metrics(stats interface{}) []Metric {
+	s := stats.(sdrStats)
+	labels := map[string]string{"device": `rtl "0"`}
+	return []Metric{
+		{Name: "sdr_samples", Help: "Samples read from the SDR.", Type: Counter, Labels: labels, Value: float64(s.Samples)},
+		{Name: "sdr_gain_db", Labels: labels, Value: s.Gain},
+	}
+}
+
+type memStats struct {
+	MemTotal uint64 `json:"memTotal"`
+	Hidden   uint64 `json:"-"`
+	Name     string `json:"name"`
+}
+
+type memProvider struct{}
+
+func (memProvider) Stats() (interface{}, error) {
+	return memStats{MemTotal: 4096, Hidden: 1, Name: "ram"}, nil
+}
+
+func (memProvider) Name() string {
+	return "memory"
+}
+
+func TestMetricsHandler(t *testing.T) {
+	providers := []Provider{sdrMetricsProvider{}, memProvider{}, staticDataProvider{Data: "ignored"}, countingProvider{name: "count", count: new(int32)}}
+	s := Stats{
+		ID:       "node1",
+		Hostname: "rpi",
+		Model:    "Raspberry Pi 4",
+		Uptime:   90 * time.Second,
+	}
+	err := s.Provide(providers...)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	h := NewMetricsHandler(func() Stats { return s }, providers...)
+
+	t.Run("prometheus text format", func(t *testing.T) {
+		rec := httptest.NewRecorder()
+		h.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/metrics", nil))
+
+		if ct := rec.Header().Get("Content-Type"); !strings.HasPrefix(ct, "text/plain; version=0.0.4") {
+			t.Fatalf("unexpected content type '%s'", ct)
+		}
+
+		exp := `# TYPE openrfsense_count gauge
+openrfsense_count{id="node1"} 1
+# TYPE openrfsense_memory_mem_total gauge
+openrfsense_memory_mem_total{id="node1"} 4096
+# HELP openrfsense_node_info Node identity, always 1.
+# TYPE openrfsense_node_info gauge
+openrfsense_node_info{hostname="rpi",id="node1",model="Raspberry Pi 4"} 1
+# HELP openrfsense_node_uptime_seconds Uptime of the node.
+# TYPE openrfsense_node_uptime_seconds gauge
+openrfsense_node_uptime_seconds{id="node1"} 90
+# TYPE openrfsense_sdr_gain_db gauge
+openrfsense_sdr_gain_db{device="rtl \"0\"",id="node1"} 20.7
+# HELP openrfsense_sdr_samples_total Samples read from the SDR.
+# TYPE openrfsense_sdr_samples_total counter
+openrfsense_sdr_samples_total{device="rtl \"0\"",id="node1"} 1024
+`
+		if got := rec.Body.String(); got != exp {
+			t.Fatalf("expected:\n%s\ngot:\n%s", exp, got)
+		}
+	})
+
+	t.Run("openmetrics format", func(t *testing.T) {
+		req := httptest.NewRequest(http.MethodGet, "/metrics", nil)
+		req.Header.Set("Accept", "application/openmetrics-text; version=1.0.0")
+		rec := httptest.NewRecorder()
+		h.ServeHTTP(rec, req)
+
+		if ct := rec.Header().Get("Content-Type"); !strings.HasPrefix(ct, "application/openmetrics-text") {
+			t.Fatalf("unexpected content type '%s'", ct)
+		}
+
+		body := rec.Body.String()
+		if !strings.HasSuffix(body, "# EOF\n") {
+			t.Fatal("expected body to end with '# EOF'")
+		}
+		if !strings.Contains(body, "# TYPE openrfsense_sdr_samples counter\nopenrfsense_sdr_samples_total{") {
+			t.Fatalf("expected counter family without _total suffix, got:\n%s", body)
+		}
+	})
+
+	t.Run("slices", func(t *testing.T) {
+		type fsStats struct {
+			Device     string `json:"device"`
+			MountPoint string `json:"mountPoint"`
+			Free       uint64 `json:"free"`
+		}
+		s := Stats{
+			ID: "node1",
+			Providers: map[string]interface{}{
+				"disk":     []fsStats{{Device: "/dev/sda1", MountPoint: "/", Free: 1024}, {Device: "/dev/sdb1", MountPoint: "/data", Free: 2048}},
+				"readings": []float64{1.5, 2},
+			},
+		}
+		rec := httptest.NewRecorder()
+		NewMetricsHandler(func() Stats { return s }).
+			ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/metrics", nil))
+
+		body := rec.Body.String()
+		for _, line := range []string{
+			`openrfsense_disk_free{device="/dev/sda1",id="node1",mount_point="/"} 1024`,
+			`openrfsense_disk_free{device="/dev/sdb1",id="node1",mount_point="/data"} 2048`,
+			`openrfsense_readings{id="node1",index="0"} 1.5`,
+			`openrfsense_readings{id="node1",index="1"} 2`,
+		} {
+			if !strings.Contains(body, line) {
+				t.Fatalf("expected output to contain '%s', got:\n%s", line, body)
+			}
+		}
+	})
+}
+
+func TestRegistry(t *testing.T) {
+	r := NewRegistry("sdr")
+
+	wg := sync.WaitGroup{}
+	for i := 0; i < 8; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for n := 0; n < 1000; n++ {
+				r.Counter("measurements").Inc()
+				r.Gauge("queue").Add(1)
+				r.Histogram("retune_seconds", 0.01, 0.1, 1).Observe(0.05)
+			}
+		}()
+	}
+	wg.Wait()
+	r.Counter("dropped").Add(3)
+	r.Gauge("gain").Set(20.7)
+	r.Histogram("retune_seconds").Observe(5)
+
+	s := Stats{}
+	err := s.Provide(r)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	got, ok := s.Providers["sdr"].(RegistryStats)
+	if !ok {
+		t.Fatalf("expected RegistryStats, got %#v", s.Providers["sdr"])
+	}
+	if got.Counters["measurements"] != 8000 || got.Counters["dropped"] != 3 {
+		t.Fatalf("unexpected counters %v", got.Counters)
+	}
+	if got.Gauges["queue"] != 8000 || got.Gauges["gain"] != 20.7 {
+		t.Fatalf("unexpected gauges %v", got.Gauges)
+	}
+
+	h := got.Histograms["retune_seconds"]
+	expBuckets := []Bucket{{0.01, 0}, {0.1, 8000}, {1, 8000}}
+	if h.Count != 8001 || !reflect.DeepEqual(h.Buckets, expBuckets) {
+		t.Fatalf("unexpected histogram %+v", h)
+	}
+	if math.Abs(h.Sum-405) > 1e-6 {
+		t.Fatalf("expected histogram sum 405, got %v", h.Sum)
+	}
+
+	t.Run("metrics", func(t *testing.T) {
+		rec := httptest.NewRecorder()
+		NewMetricsHandler(func() Stats { return s }, r).
+			ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/metrics", nil))
+
+		body := rec.Body.String()
+		for _, line := range []string{
+			"# TYPE openrfsense_sdr_dropped_total counter\n",
+			`openrfsense_sdr_measurements_total{id=""} 8000`,
+			`openrfsense_sdr_gain{id=""} 20.7`,
+			`openrfsense_sdr_retune_seconds_bucket{id="",le="0.1"} 8000`,
+			`openrfsense_sdr_retune_seconds_bucket{id="",le="+Inf"} 8001`,
+			"# TYPE openrfsense_sdr_retune_seconds histogram\n",
+			`openrfsense_sdr_retune_seconds_sum{id=""} 405`,
+			`openrfsense_sdr_retune_seconds_count{id=""} 8001`,
+		} {
+			if !strings.Contains(body, line) {
+				t.Fatalf("expected output to contain '%s', got:\n%s", line, body)
+			}
+		}
+		for _, suffix := range []string{"bucket", "sum", "count"} {
+			if strings.Contains(body, "# TYPE openrfsense_sdr_retune_seconds_"+suffix) {
+				t.Fatalf("expected a single histogram family, got:\n%s", body)
+			}
+		}
+	})
+}
+
+func TestUptimeJSON(t *testing.T) {
+	t.Run("encoding", func(t *testing.T) {
+		s := Stats{ID: "id", Uptime: 26*time.Hour + 3*time.Minute + 4500*time.Millisecond}
+
+		raw, err := json.Marshal(s)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		fields := map[string]interface{}{}
+		err = json.Unmarshal(raw, &fields)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if fields["uptime"] != "PT26H3M4.5S" {
+			t.Fatalf("expected uptime 'PT26H3M4.5S', got %v", fields["uptime"])
+		}
+		if fields["uptimeSeconds"] != 93784.5 {
+			t.Fatalf("expected uptimeSeconds 93784.5, got %v", fields["uptimeSeconds"])
+		}
+
+		if _, ok := fields["bootTime"]; ok {
+			t.Fatalf("expected no bootTime, got %v", fields["bootTime"])
+		}
+
+		again, err := json.Marshal(s)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !bytes.Equal(raw, again) {
+			t.Fatalf("expected the same encoding twice, got %s and %s", raw, again)
+		}
+
+		s.BootTime = time.Date(2022, 6, 1, 12, 0, 0, 0, time.UTC)
+		if raw, _ = json.Marshal(s); !bytes.Contains(raw, []byte(`"bootTime":"2022-06-01T12:00:00Z"`)) {
+			t.Fatalf("expected bootTime to be encoded, got %s", raw)
+		}
+	})
+
+	t.Run("decoding", func(t *testing.T) {
+		boot := time.Date(2022, 6, 1, 12, 0, 0, 0, time.UTC)
+		tests := map[string]struct {
+			payload string
+			exp     time.Duration
+		}{
+			"seconds":        {`{"uptimeSeconds":3600.25}`, time.Hour + 250*time.Millisecond},
+			"iso 8601":       {`{"uptime":"P1DT0.5S"}`, 24*time.Hour + 500*time.Millisecond},
+			"both":           {`{"uptime":"PT1S","uptimeSeconds":2}`, 2 * time.Second},
+			"old nanosecond": {`{"uptime":3600000000000}`, time.Hour},
+			"missing":        {`{"id":"id"}`, 0},
+			"boot time":      {`{"uptime":"PT1H","bootTime":"2022-06-01T12:00:00Z"}`, time.Hour},
+		}
+
+		for name, tt := range tests {
+			t.Run(name, func(t *testing.T) {
+				s := Stats{}
+				err := json.Unmarshal([]byte(tt.payload), &s)
+				if err != nil {
+					t.Fatal(err)
+				}
+				if s.Uptime != tt.exp {
+					t.Fatalf("expected uptime %v, got %v", tt.exp, s.Uptime)
+				}
+				if name == "boot time" && !s.BootTime.Equal(boot) {
+					t.Fatalf("expected bootTime %v, got %v", boot, s.BootTime)
+				}
+			})
+		}
+
+		err := json.Unmarshal([]byte(`{"uptime":"1h"}`), &Stats{})
+		if err == nil {
+			t.Fatal("err should not be nil")
+		}
+	})
+}
+
+func TestISODuration(t *testing.T) {
+	tests := map[string]time.Duration{
+		"PT0S":                        0,
+		"PT1H":                        time.Hour,
+		"PT1M30S":                     90 * time.Second,
+		"PT0.000000001S":              1,
+		"PT49H0.5S":                   49*time.Hour + 500*time.Millisecond,
+		"-PT2M":                       -2 * time.Minute,
+		"PT2562047H47M16.854775807S":  math.MaxInt64,
+		"-PT2562047H47M16.854775808S": math.MinInt64,
+		"PT2562047H47M16.854775806S":  math.MaxInt64 - 1,
+	}
+	for iso, d := range tests {
+		if got := FormatISODuration(d); got != iso {
+			t.Errorf("expected %v to be formatted as '%s', got '%s'", d, iso, got)
+		}
+		got, err := ParseISODuration(iso)
+		if err != nil {
+			t.Errorf("parsing '%s': %v", iso, err)
+		}
+		if got != d {
+			t.Errorf("expected '%s' to be parsed as %v, got %v", iso, d, got)
+		}
+	}
+
+	parsed := map[string]time.Duration{
+		"P1W":     7 * 24 * time.Hour,
+		"P1DT12H": 36 * time.Hour,
+		"PT1,5M":  90 * time.Second,
+		"P0D":     0,
+		"PT.5S":   500 * time.Millisecond,
+		"PT1.5S":  1500 * time.Millisecond,
+		"P1.5W":   252 * time.Hour,
+
+		"PT0.0000000005S":             1,
+		"PT0.00000000049999999999S":   0,
+		"PT1.0000000000000000000001S": time.Second,
+	}
+	for iso, d := range parsed {
+		got, err := ParseISODuration(iso)
+		if err != nil || got != d {
+			t.Errorf("expected '%s' to be parsed as %v, got %v (%v)", iso, d, got, err)
+		}
+	}
+
+	for _, invalid := range []string{"", "P", "PT", "1H", "P1Y", "P1M", "PT1D", "P1H", "PT1.5H30M", "PTxS", "P1DT", "PT.S", "PT1.2.3S", "PT2562047H47M16.854775808S", "PT99999999999999999999S", "P15251W"} {
+		if _, err := ParseISODuration(invalid); err == nil {
+			t.Errorf("expected '%s' to be invalid", invalid)
+		}
+	}
+}
+
+func TestNewSystem(t *testing.T) {
+	t.Run("raspberry pi", func(t *testing.T) {
+		s, err := NewSystemAt("testdata/rpi")
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if s.Hostname != "node-rpi" {
+			t.Fatalf("expected hostname 'node-rpi', got '%s'", s.Hostname)
+		}
+		if s.Model != "Raspberry Pi 4 Model B Rev 1.4" {
+			t.Fatalf("expected device-tree model, got '%s'", s.Model)
+		}
+		if exp := 123456*time.Second + 780*time.Millisecond; s.Uptime != exp {
+			t.Fatalf("expected uptime %v, got %v", exp, s.Uptime)
+		}
+		if exp := id.GenerateFromSeed(hashSeed("10000000a1b2c3d4"), IDLength); s.ID != exp {
+			t.Fatalf("expected ID '%s' from serial number, got '%s'", exp, s.ID)
+		}
+
+		again, err := NewSystemAt("testdata/rpi")
+		if err != nil {
+			t.Fatal(err)
+		}
+		if again.ID != s.ID {
+			t.Fatalf("expected a stable ID, got '%s' and '%s'", s.ID, again.ID)
+		}
+	})
+
+	t.Run("distinct serials", func(t *testing.T) {
+		ids := map[string]string{}
+		for _, serial := range []string{"10000000a1b2c3d4", "10000000d4c3b2a1", "00000001a1b2c3d4"} {
+			root := t.TempDir()
+			for path, content := range map[string]string{
+				"proc/sys/kernel/hostname":                   "node",
+				"proc/uptime":                                "1.00 1.00",
+				"sys/firmware/devicetree/base/serial-number": serial + "\x00",
+			} {
+				if err := os.MkdirAll(filepath.Dir(filepath.Join(root, path)), 0o755); err != nil {
+					t.Fatal(err)
+				}
+				if err := os.WriteFile(filepath.Join(root, path), []byte(content), 0o644); err != nil {
+					t.Fatal(err)
+				}
+			}
+
+			s, err := NewSystemAt(root)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if other, dup := ids[s.ID]; dup {
+				t.Fatalf("expected different IDs, got '%s' for both %s and %s", s.ID, other, serial)
+			}
+			ids[s.ID] = serial
+		}
+	})
+
+	t.Run("x86", func(t *testing.T) {
+		s, err := NewSystemAt("testdata/x86")
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if s.Hostname != "node-x86" {
+			t.Fatalf("expected hostname 'node-x86' from /etc/hostname, got '%s'", s.Hostname)
+		}
+		if s.Model != "Dell Inc. OptiPlex 7040" {
+			t.Fatalf("expected DMI model, got '%s'", s.Model)
+		}
+		if exp := id.GenerateFromSeed(hashSeed("0f1e2d3c4b5a69788796a5b4c3d2e1f0"), IDLength); s.ID != exp {
+			t.Fatalf("expected ID '%s' from machine-id, got '%s'", exp, s.ID)
+		}
+		if s.Uptime != time.Minute {
+			t.Fatalf("expected uptime 1m, got %v", s.Uptime)
+		}
+	})
+
+	t.Run("no hardware id", func(t *testing.T) {
+		_, err := NewSystemAt("testdata/empty")
+		if err == nil || !strings.Contains(err.Error(), "hardware ID") {
+			t.Fatalf("expected a hardware ID error, got %v", err)
+		}
+	})
+
+	t.Run("no hostname", func(t *testing.T) {
+		_, err := NewSystemAt(t.TempDir())
+		if err == nil || !strings.Contains(err.Error(), "hostname") {
+			t.Fatalf("expected a hostname error, got %v", err)
+		}
+	})
+}
+
+func TestHashSeed(t *testing.T) {
+	if hashSeed("10000000a1b2c3d4") != hashSeed("10000000a1b2c3d4") {
+		t.Fatal("expected the same seed for the same serial")
+	}
+
+	// Anagrams have the same byte sum, which used to give the same seed
+	seeds := map[int64]string{}
+	for _, serial := range []string{"", "10000000a1b2c3d4", "10000000d4c3b2a1", "00000001a1b2c3d4"} {
+		seed := hashSeed(serial)
+		if other, dup := seeds[seed]; dup {
+			t.Fatalf("expected different seeds, got %d for both '%s' and '%s'", seed, other, serial)
+		}
+		seeds[seed] = serial
+	}
+}
+
+func TestDiff(t *testing.T) {
+	boot := time.Date(2022, 6, 1, 12, 0, 0, 0, time.UTC)
+	prev := Stats{
+		ID:       "id",
+		Hostname: "node",
+		Uptime:   time.Hour,
+		BootTime: boot,
+		Providers: map[string]interface{}{
+			"memory": memStats{MemTotal: 1<<53 + 1, Name: "ram"},
+			"list":   []int{1, 2, 3},
+			"a/b":    "gone",
+		},
+	}
+	next := Stats{
+		ID:       "id",
+		Hostname: "node-renamed",
+		Uptime:   time.Hour + time.Minute,
+		BootTime: boot.Add(time.Second),
+		Providers: map[string]interface{}{
+			"memory": memStats{MemTotal: 1 << 53, Name: "ram"},
+			"list":   []int{1, 5},
+			"sdr":    map[string]interface{}{"gain": 20.7},
+		},
+	}
+
+	changes, err := Diff(prev, next)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	exp := Changes{
+		{Type: Changed, Path: "/hostname", Old: "node", New: "node-renamed"},
+		{Type: Removed, Path: "/providers/a~1b", Old: "gone"},
+		{Type: Changed, Path: "/providers/list/1", Old: json.Number("2"), New: json.Number("5")},
+		{Type: Removed, Path: "/providers/list/2", Old: json.Number("3")},
+		{Type: Changed, Path: "/providers/memory/memTotal", Old: json.Number("9007199254740993"), New: json.Number("9007199254740992")},
+		{Type: Added, Path: "/providers/sdr", New: map[string]interface{}{"gain": json.Number("20.7")}},
+	}
+	if !reflect.DeepEqual(changes, exp) {
+		t.Fatalf("expected %+v, got %+v", exp, changes)
+	}
+
+	patch, err := changes.JSONPatch()
+	if err != nil {
+		t.Fatal(err)
+	}
+	expPatch := `[{"op":"replace","path":"/hostname","value":"node-renamed"},` +
+		`{"op":"remove","path":"/providers/a~1b"},` +
+		`{"op":"replace","path":"/providers/list/1","value":5},` +
+		`{"op":"remove","path":"/providers/list/2"},` +
+		`{"op":"replace","path":"/providers/memory/memTotal","value":9007199254740992},` +
+		`{"op":"add","path":"/providers/sdr","value":{"gain":20.7}}]`
+	if string(patch) != expPatch {
+		t.Fatalf("expected patch '%s', got '%s'", expPatch, patch)
+	}
+
+	t.Run("apply", func(t *testing.T) {
+		patched, err := ApplyPatch(prev, patch)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		changes, err := Diff(patched, next)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(changes) != 0 {
+			t.Fatalf("expected no changes after applying the patch, got %+v", changes)
+		}
+		if prev.Hostname != "node" {
+			t.Fatal("expected ApplyPatch not to modify its argument")
+		}
+	})
+
+	t.Run("no changes", func(t *testing.T) {
+		changes, err := Diff(prev, prev)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(changes) != 0 {
+			t.Fatalf("expected no changes, got %+v", changes)
+		}
+	})
+
+	t.Run("consecutive reports", func(t *testing.T) {
+		first := Stats{ID: "id", Uptime: 10*time.Minute + 300*time.Millisecond, BootTime: boot}
+		second := first
+		second.Uptime += time.Minute
+		second.BootTime = boot.Add(time.Second)
+
+		changes, err := Diff(first, second)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(changes) != 0 {
+			t.Fatalf("expected no changes, got %+v", changes)
+		}
+	})
+
+	t.Run("invalid patch", func(t *testing.T) {
+		for _, patch := range []string{`[{"op":"remove","path":"/providers/missing"}]`, `[] []`} {
+			if _, err := ApplyPatch(prev, []byte(patch)); err == nil {
+				t.Fatalf("expected an error for '%s'", patch)
+			}
+		}
+	})
+}
+
+type lifecycleProvider struct {
+	name    string
+	events  *[]string
+	initErr error
+}
+
+func (lp lifecycleProvider) Stats() (interface{}, error) {
+	return nil, nil
+}
+
+func (lp lifecycleProvider) Name() string {
+	return lp.name
+}
+
+func (lp lifecycleProvider) Init() error {
+	*lp.events = append(*lp.events, "init "+lp.name)
+	return lp.initErr
+}
+
+func (lp lifecycleProvider) Close() error {
+	*lp.events = append(*lp.events, "close "+lp.name)
+	return nil
+}
+
+func TestSet(t *testing.T) {
+	t.Run("init and close", func(t *testing.T) {
+		events := []string{}
+		set := NewSet(
+			lifecycleProvider{name: "gps", events: &events},
+			fsProvider{},
+			lifecycleProvider{name: "sdr", events: &events},
+		)
+
+		if err := set.Init(); err != nil {
+			t.Fatal(err)
+		}
+		if err := set.Init(); err != nil {
+			t.Fatal(err)
+		}
+		if err := set.Close(); err != nil {
+			t.Fatal(err)
+		}
+
+		exp := []string{"init gps", "init sdr", "close sdr", "close gps"}
+		if !reflect.DeepEqual(events, exp) {
+			t.Fatalf("expected %v, got %v", exp, events)
+		}
+		if len(set.Providers()) != 3 {
+			t.Fatalf("expected 3 providers, got %d", len(set.Providers()))
+		}
+	})
+
+	t.Run("failed init", func(t *testing.T) {
+		events := []string{}
+		set := NewSet(
+			lifecycleProvider{name: "gps", events: &events},
+			lifecycleProvider{name: "sdr", events: &events, initErr: errSDR},
+			lifecycleProvider{name: "never", events: &events},
+		)
+
+		err := set.Init()
+		var perr *ProviderError
+		if !errors.As(err, &perr) || perr.Provider != "sdr" || !errors.Is(err, errSDR) {
+			t.Fatalf("expected sdr provider error, got %v", err)
+		}
+
+		exp := []string{"init gps", "init sdr", "close gps"}
+		if !reflect.DeepEqual(events, exp) {
+			t.Fatalf("expected %v, got %v", exp, events)
+		}
+	})
+}
+
+func TestRegister(t *testing.T) {
+	Register(staticDataProvider{Data: "registered"})
+	t.Cleanup(func() {
+		registered.Lock()
+		delete(registered.providers, "staticData")
+		registered.Unlock()
+	})
+
+	found := false
+	for _, p := range Registered() {
+		if p.Name() == "staticData" {
+			found = true
+		}
+	}
+	if !found {
+		t.Fatal("expected staticData provider to be registered")
+	}
+
+	defer func() {
+		if recover() == nil {
+			t.Fatal("expected registering a duplicate provider to panic")
+		}
+	}()
+	Register(staticDataProvider{})
+}
+
+type flakyProvider struct {
+	calls *int32
+	fail  *int32
+	delay time.Duration
+}
+
+func (fp flakyProvider) Stats() (interface{}, error) {
+	n := atomic.AddInt32(fp.calls, 1)
+	time.Sleep(fp.delay)
+	if atomic.LoadInt32(fp.fail) != 0 {
+		return nil, errSDR
+	}
+	return n, nil
+}
+
+func (flakyProvider) Name() string {
+	return "smart"
+}
+
+// Calls fn until it returns true, failing the test after a second.
+func eventually(t *testing.T, fn func() bool) {
+	t.Helper()
+	deadline := time.Now().Add(time.Second)
+	for !fn() {
+		if time.Now().After(deadline) {
+			t.Fatal("condition not met in time")
+		}
+		time.Sleep(time.Millisecond)
+	}
+}
+
+func TestCached(t *testing.T) {
+	calls, fail := int32(0), int32(0)
+	c := NewCached(flakyProvider{calls: &calls, fail: &fail}, 20*time.Millisecond)
+
+	if c.Name() != "smart" {
+		t.Fatalf("expected name of the wrapped provider, got '%s'", c.Name())
+	}
+
+	got, err := c.Stats()
+	if err != nil || got != int32(1) {
+		t.Fatalf("expected first call to reach the provider, got %v (%v)", got, err)
+	}
+
+	got, err = c.Stats()
+	if err != nil || got != int32(1) {
+		t.Fatalf("expected cached value within TTL, got %v (%v)", got, err)
+	}
+	if n := atomic.LoadInt32(&calls); n != 1 {
+		t.Fatalf("expected 1 call to the provider, got %d", n)
+	}
+
+	// Expired: the old value is served while refreshing in the background
+	time.Sleep(25 * time.Millisecond)
+	got, err = c.Stats()
+	if err != nil || got != int32(1) {
+		t.Fatalf("expected stale value while refreshing, got %v (%v)", got, err)
+	}
+	eventually(t, func() bool {
+		got, _ := c.Stats()
+		return got == int32(2)
+	})
+
+	// Failed refresh: the last good value is marked as stale
+	atomic.StoreInt32(&fail, 1)
+	time.Sleep(25 * time.Millisecond)
+	c.Stats()
+	eventually(t, func() bool {
+		_, err := c.Stats()
+		return err != nil
+	})
+
+	s := Stats{}
+	err = s.Provide(c)
+	var stale *StaleError
+	if !errors.As(err, &stale) || !errors.Is(err, errSDR) {
+		t.Fatalf("expected a StaleError wrapping the provider error, got %v", err)
+	}
+	if s.Providers["smart"] != int32(2) {
+		t.Fatalf("expected the last good value to be provided, got %v", s.Providers["smart"])
+	}
+	if !strings.HasPrefix(s.Errors["smart"], "stale since ") {
+		t.Fatalf("expected the error to mark the value as stale, got '%s'", s.Errors["smart"])
+	}
+
+	// Recovery clears the marker
+	atomic.StoreInt32(&fail, 0)
+	eventually(t, func() bool {
+		_, err := c.Stats()
+		return err == nil
+	})
+
+	t.Run("failing provider", func(t *testing.T) {
+		calls, fail := int32(0), int32(1)
+		c := NewCached(flakyProvider{calls: &calls, fail: &fail}, 20*time.Millisecond)
+
+		for start := time.Now(); time.Since(start) < 100*time.Millisecond; {
+			if _, err := c.Stats(); !errors.Is(err, errSDR) {
+				t.Fatalf("expected the provider error, got %v", err)
+			}
+			time.Sleep(100 * time.Microsecond)
+		}
+		// One call every 20ms at most, plus some slack for the scheduler
+		if n := atomic.LoadInt32(&calls); n > 8 {
+			t.Fatalf("expected failed refreshes to be retried once per TTL, got %d calls", n)
+		}
+	})
+
+	t.Run("concurrent first calls", func(t *testing.T) {
+		calls, fail := int32(0), int32(0)
+		c := NewCached(flakyProvider{calls: &calls, fail: &fail, delay: 20 * time.Millisecond}, time.Minute)
+
+		wg := sync.WaitGroup{}
+		for i := 0; i < 10; i++ {
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				if got, err := c.Stats(); err != nil || got != int32(1) {
+					t.Errorf("expected the shared first value, got %v (%v)", got, err)
+				}
+			}()
+		}
+		wg.Wait()
+		if n := atomic.LoadInt32(&calls); n != 1 {
+			t.Fatalf("expected 1 call to the provider, got %d", n)
+		}
+	})
+
+	t.Run("timeout", func(t *testing.T) {
+		if got := NewCached(slowProvider{timeout: 50 * time.Millisecond}, time.Minute).Timeout(); got != 50*time.Millisecond {
+			t.Fatalf("expected the timeout of the wrapped provider, got %v", got)
+		}
+		if got := NewCached(staticDataProvider{}, time.Minute).Timeout(); got != DefaultTimeout {
+			t.Fatalf("expected DefaultTimeout, got %v", got)
+		}
+	})
+
+	t.Run("context", func(t *testing.T) {
+		// The refresh of a ContextProvider is interrupted after its timeout
+		start := time.Now()
+		if _, err := NewCached(ctxProvider{}, time.Minute).Stats(); !errors.Is(err, context.DeadlineExceeded) {
+			t.Fatalf("expected context.DeadlineExceeded, got %v", err)
+		}
+		if elapsed := time.Since(start); elapsed > 500*time.Millisecond {
+			t.Fatalf("expected the refresh to be interrupted, took %v", elapsed)
+		}
+
+		// Callers stop waiting once their context is done
+		c := NewCached(slowProvider{name: "slow", delay: 100 * time.Millisecond}, time.Minute)
+		ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+		defer cancel()
+		start = time.Now()
+		if _, err := c.StatsContext(ctx); !errors.Is(err, context.DeadlineExceeded) {
+			t.Fatalf("expected context.DeadlineExceeded, got %v", err)
+		}
+		if elapsed := time.Since(start); elapsed > 80*time.Millisecond {
+			t.Fatalf("expected StatsContext to return once ctx is done, took %v", elapsed)
+		}
+
+		// The refresh keeps running for the next callers
+		if got, err := c.Stats(); err != nil || got != "100ms" {
+			t.Fatalf("expected the refreshed value, got %v (%v)", got, err)
+		}
+	})
+}
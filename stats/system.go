@@ -0,0 +1,142 @@
+// Copyright (C) 2022 OpenRFSense
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Affero General Public License as
+// published by the Free Software Foundation, either version 3 of the
+// License, or (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU Affero General Public License for more details.
+//
+// You should have received a copy of the GNU Affero General Public License
+// along with this program.  If not, see <http://www.gnu.org/licenses/>.
+
+package stats
+
+import (
+	"crypto/sha256"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/openrfsense/common/id"
+)
+
+// Length of the node ID generated by NewSystem.
+const IDLength = 16
+
+// Files holding a hardware-bound identifier, in order of preference. The
+// device-tree serial number is the SoC serial on ARM boards such as the
+// Raspberry Pi, product_uuid is the SMBIOS UUID on x86.
+var idSources = []string{
+	"sys/firmware/devicetree/base/serial-number",
+	"proc/device-tree/serial-number",
+	"sys/class/dmi/id/product_uuid",
+	"etc/machine-id",
+}
+
+// Creates Stats describing the running system: hostname, hardware model, uptime
+// and a hardware-bound ID generated with package id.
+func NewSystem() (*Stats, error) {
+	return NewSystemAt("/")
+}
+
+// Same as NewSystem, but reads every file relative to root instead of "/", so a
+// fake /proc, /sys and /etc tree can be used. The hostname is read from
+// /proc/sys/kernel/hostname or /etc/hostname, and only asked to the kernel if
+// root is "/".
+func NewSystemAt(root string) (*Stats, error) {
+	hostname, err := readTrimmed(root, "proc/sys/kernel/hostname")
+	if err != nil {
+		hostname, err = readTrimmed(root, "etc/hostname")
+	}
+	if err != nil && filepath.Clean(root) == "/" {
+		hostname, err = os.Hostname()
+	}
+	if err != nil {
+		return nil, fmt.Errorf("reading hostname: %w", err)
+	}
+
+	uptime, err := readUptime(root)
+	if err != nil {
+		return nil, fmt.Errorf("reading uptime: %w", err)
+	}
+
+	seed, err := hardwareID(root)
+	if err != nil {
+		return nil, fmt.Errorf("reading hardware ID: %w", err)
+	}
+
+	return &Stats{
+		ID:       id.GenerateFromSeed(hashSeed(seed), IDLength),
+		Hostname: hostname,
+		Model:    readModel(root),
+		Uptime:   uptime,
+	}, nil
+}
+
+// Reads a file relative to root, trimming whitespace and the NUL terminator used
+// by device-tree properties.
+func readTrimmed(root string, path string) (string, error) {
+	raw, err := os.ReadFile(filepath.Join(root, path))
+	if err != nil {
+		return "", err
+	}
+	return strings.TrimSpace(strings.TrimRight(string(raw), "\x00")), nil
+}
+
+// Reads the system uptime from the first field of /proc/uptime.
+func readUptime(root string) (time.Duration, error) {
+	raw, err := readTrimmed(root, "proc/uptime")
+	if err != nil {
+		return 0, err
+	}
+
+	fields := strings.Fields(raw)
+	if len(fields) == 0 {
+		return 0, fmt.Errorf("unexpected format %q", raw)
+	}
+	seconds, err := strconv.ParseFloat(fields[0], 64)
+	if err != nil {
+		return 0, err
+	}
+	return time.Duration(seconds * float64(time.Second)), nil
+}
+
+// Returns the device-tree model if present (ARM boards), otherwise the DMI vendor
+// and product name (x86). Returns an empty string if neither is available.
+func readModel(root string) string {
+	for _, path := range []string{"sys/firmware/devicetree/base/model", "proc/device-tree/model"} {
+		if model, err := readTrimmed(root, path); err == nil && model != "" {
+			return model
+		}
+	}
+
+	product, _ := readTrimmed(root, "sys/class/dmi/id/product_name")
+	vendor, _ := readTrimmed(root, "sys/class/dmi/id/sys_vendor")
+	return strings.TrimSpace(vendor + " " + product)
+}
+
+// Reduces a hardware identifier to a generator seed, using the first 8 bytes of
+// its SHA-256 digest so that every bit of the identifier affects the ID.
+func hashSeed(serial string) int64 {
+	sum := sha256.Sum256([]byte(serial))
+	return int64(binary.BigEndian.Uint64(sum[:8]))
+}
+
+// Returns the first non-empty hardware identifier in idSources.
+func hardwareID(root string) (string, error) {
+	for _, path := range idSources {
+		if serial, err := readTrimmed(root, path); err == nil && serial != "" {
+			return serial, nil
+		}
+	}
+	return "", errors.New("no hardware identifier found")
+}
@@ -0,0 +1,244 @@
+// Copyright (C) 2022 OpenRFSense
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Affero General Public License as
+// published by the Free Software Foundation, either version 3 of the
+// License, or (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU Affero General Public License for more details.
+//
+// You should have received a copy of the GNU Affero General Public License
+// along with this program.  If not, see <http://www.gnu.org/licenses/>.
+
+package stats
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"math"
+	"math/bits"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Encodes Stats to JSON. Uptime is written both as an ISO 8601 duration
+// ("uptime") and as a number of seconds ("uptimeSeconds"). BootTime is left out
+// if not set, so that encoding the same Stats always gives the same output.
+func (s Stats) MarshalJSON() ([]byte, error) {
+	type plain Stats
+	aux := struct {
+		plain
+		Uptime        string     `json:"uptime"`
+		UptimeSeconds float64    `json:"uptimeSeconds"`
+		BootTime      *time.Time `json:"bootTime,omitempty"`
+	}{
+		plain:         plain(s),
+		Uptime:        FormatISODuration(s.Uptime),
+		UptimeSeconds: s.Uptime.Seconds(),
+	}
+
+	if !s.BootTime.IsZero() {
+		aux.BootTime = &s.BootTime
+	}
+
+	return json.Marshal(aux)
+}
+
+// Decodes the uptime from either "uptimeSeconds", or "uptime" as an ISO 8601
+// duration or, for payloads produced by older versions, as nanoseconds.
+func decodeUptime(raw json.RawMessage, seconds *float64) (time.Duration, error) {
+	if seconds != nil {
+		return time.Duration(math.Round(*seconds * float64(time.Second))), nil
+	}
+
+	if len(raw) == 0 || bytes.Equal(raw, []byte("null")) {
+		return 0, nil
+	}
+
+	if raw[0] == '"' {
+		var iso string
+		if err := json.Unmarshal(raw, &iso); err != nil {
+			return 0, err
+		}
+		return ParseISODuration(iso)
+	}
+
+	var nanos int64
+	if err := json.Unmarshal(raw, &nanos); err != nil {
+		return 0, fmt.Errorf("decoding uptime: %w", err)
+	}
+	return time.Duration(nanos), nil
+}
+
+// Formats d as an ISO 8601 duration using hours, minutes and seconds only, such
+// as "PT26H3M4.5S". Negative durations are prefixed with '-'.
+func FormatISODuration(d time.Duration) string {
+	if d == 0 {
+		return "PT0S"
+	}
+
+	b := strings.Builder{}
+	// Work with uint64 so that math.MinInt64 can be negated
+	u := uint64(d)
+	if d < 0 {
+		b.WriteByte('-')
+		u = -u
+	}
+	b.WriteString("PT")
+
+	hours := u / uint64(time.Hour)
+	u -= hours * uint64(time.Hour)
+	minutes := u / uint64(time.Minute)
+	u -= minutes * uint64(time.Minute)
+
+	if hours > 0 {
+		b.WriteString(strconv.FormatUint(hours, 10))
+		b.WriteByte('H')
+	}
+	if minutes > 0 {
+		b.WriteString(strconv.FormatUint(minutes, 10))
+		b.WriteByte('M')
+	}
+	if u > 0 {
+		secs := u / uint64(time.Second)
+		frac := u % uint64(time.Second)
+		b.WriteString(strconv.FormatUint(secs, 10))
+		if frac > 0 {
+			b.WriteByte('.')
+			b.WriteString(strings.TrimRight(fmt.Sprintf("%09d", frac), "0"))
+		}
+		b.WriteByte('S')
+	}
+
+	return b.String()
+}
+
+// Parses an ISO 8601 duration made of weeks, days, hours, minutes and seconds,
+// such as "P1DT2H" or "PT0.5S". Days are taken as 24 hours. Years and months are
+// rejected, since their length is not fixed. The last component may have a
+// fractional part.
+func ParseISODuration(s string) (time.Duration, error) {
+	orig := s
+	neg := false
+	if strings.HasPrefix(s, "-") {
+		neg = true
+		s = s[1:]
+	}
+	if !strings.HasPrefix(s, "P") || len(s) < 3 {
+		return 0, fmt.Errorf("invalid ISO 8601 duration %q", orig)
+	}
+	s = s[1:]
+
+	// Accumulate nanoseconds in a uint64 so that math.MinInt64 can be parsed
+	var total uint64
+	inTime := false
+	last := false
+	for len(s) > 0 {
+		if s[0] == 'T' {
+			if inTime || len(s) == 1 {
+				return 0, fmt.Errorf("invalid ISO 8601 duration %q", orig)
+			}
+			inTime = true
+			s = s[1:]
+			continue
+		}
+		if last {
+			return 0, fmt.Errorf("invalid ISO 8601 duration %q: fraction must be in the last component", orig)
+		}
+
+		i := strings.IndexFunc(s, func(r rune) bool {
+			return (r < '0' || r > '9') && r != '.' && r != ','
+		})
+		if i <= 0 {
+			return 0, fmt.Errorf("invalid ISO 8601 duration %q", orig)
+		}
+		whole, frac, hasFrac := strings.Cut(strings.Replace(s[:i], ",", ".", 1), ".")
+		if (whole == "" && frac == "") || strings.ContainsAny(frac, ".,") {
+			return 0, fmt.Errorf("invalid ISO 8601 duration %q", orig)
+		}
+		last = hasFrac
+
+		var unit time.Duration
+		switch designator := s[i]; {
+		case !inTime && designator == 'W':
+			unit = 7 * 24 * time.Hour
+		case !inTime && designator == 'D':
+			unit = 24 * time.Hour
+		case inTime && designator == 'H':
+			unit = time.Hour
+		case inTime && designator == 'M':
+			unit = time.Minute
+		case inTime && designator == 'S':
+			unit = time.Second
+		default:
+			return 0, fmt.Errorf("invalid ISO 8601 duration %q: unsupported designator %q", orig, designator)
+		}
+		value, ok := componentNanos(whole, frac, uint64(unit))
+		if !ok || total+value < total {
+			return 0, fmt.Errorf("invalid ISO 8601 duration %q: overflow", orig)
+		}
+		total += value
+		s = s[i+1:]
+	}
+
+	limit := uint64(math.MaxInt64)
+	if neg {
+		limit++
+	}
+	if total > limit {
+		return 0, fmt.Errorf("invalid ISO 8601 duration %q: overflow", orig)
+	}
+	d := time.Duration(total)
+	if neg {
+		d = -d
+	}
+	return d, nil
+}
+
+// Returns the nanoseconds in whole.frac units of the given length, rounding the
+// fraction to the nearest nanosecond, and false if the result overflows a uint64.
+func componentNanos(whole string, frac string, unit uint64) (uint64, bool) {
+	var n uint64
+	if whole != "" {
+		w, err := strconv.ParseUint(whole, 10, 64)
+		if err != nil {
+			return 0, false
+		}
+		hi, lo := bits.Mul64(w, unit)
+		if hi != 0 {
+			return 0, false
+		}
+		n = lo
+	}
+
+	// Digits past the 19th are below a nanosecond even for weeks
+	if len(frac) > 19 {
+		frac = frac[:19]
+	}
+	if frac == "" {
+		return n, true
+	}
+	f, err := strconv.ParseUint(frac, 10, 64)
+	if err != nil {
+		return 0, false
+	}
+	scale := uint64(1)
+	for range frac {
+		scale *= 10
+	}
+	// unit*f < unit*scale, so the high half is always lower than scale
+	hi, lo := bits.Mul64(f, unit)
+	q, r := bits.Div64(hi, lo, scale)
+	if r >= scale-r {
+		q++
+	}
+	if n+q < n {
+		return 0, false
+	}
+	return n + q, true
+}
@@ -0,0 +1,197 @@
+// Copyright (C) 2022 OpenRFSense
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Affero General Public License as
+// published by the Free Software Foundation, either version 3 of the
+// License, or (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU Affero General Public License for more details.
+//
+// You should have received a copy of the GNU Affero General Public License
+// along with this program.  If not, see <http://www.gnu.org/licenses/>.
+
+package types
+
+import (
+	"errors"
+	"fmt"
+	"math"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Type Aggregation is the function used to combine the power measured in a
+// frequency bin over a time resolution window. It is encoded in JSON as a string.
+type Aggregation string
+
+const (
+	// Arithmetic mean of the dBm values. The default.
+	AggregationAvg Aggregation = "avg"
+	// Lowest dBm value.
+	AggregationMin Aggregation = "min"
+	// Highest dBm value.
+	AggregationMax Aggregation = "max"
+	// Median of the dBm values, same as Percentile(50).
+	AggregationMedian Aggregation = "median"
+	// Mean of the linear power (mW), converted back to dBm. This is the RMS of
+	// the signal amplitude, as opposed to AggregationAvg which averages in the
+	// logarithmic domain.
+	AggregationRMS Aggregation = "rms"
+)
+
+// Returns the aggregation computing the n-th percentile (0 to 100) of the dBm
+// values, with linear interpolation between the closest ranks. Encoded as "pN",
+// such as "p95".
+func Percentile(n float64) Aggregation {
+	return Aggregation("p" + strconv.FormatFloat(n, 'f', -1, 64))
+}
+
+// Returns the percentile for percentile aggregations, and false for any other.
+func (a Aggregation) Percentile() (float64, bool) {
+	if !strings.HasPrefix(string(a), "p") {
+		return 0, false
+	}
+	n, err := strconv.ParseFloat(string(a[1:]), 64)
+	if err != nil || n < 0 || n > 100 || math.IsNaN(n) {
+		return 0, false
+	}
+	return n, true
+}
+
+// Validates the aggregation. The empty value is valid and means AggregationAvg.
+func (a Aggregation) Validate() error {
+	switch a {
+	case "", AggregationAvg, AggregationMin, AggregationMax, AggregationMedian, AggregationRMS:
+		return nil
+	}
+	if _, ok := a.Percentile(); ok {
+		return nil
+	}
+	return ErrAggregationInvalid
+}
+
+// Combines the given dBm values into one. Returns NaN if values is empty or the
+// aggregation is invalid. values may be reordered.
+func (a Aggregation) Apply(values []float64) float64 {
+	if len(values) == 0 {
+		return math.NaN()
+	}
+
+	switch a {
+	case "", AggregationAvg:
+		sum := 0.0
+		for _, v := range values {
+			sum += v
+		}
+		return sum / float64(len(values))
+	case AggregationMin:
+		ret := values[0]
+		for _, v := range values[1:] {
+			ret = math.Min(ret, v)
+		}
+		return ret
+	case AggregationMax:
+		ret := values[0]
+		for _, v := range values[1:] {
+			ret = math.Max(ret, v)
+		}
+		return ret
+	case AggregationMedian:
+		return percentile(values, 50)
+	case AggregationRMS:
+		sum := 0.0
+		for _, v := range values {
+			sum += Power(v).Milliwatts()
+		}
+		return PowerFromMilliwatts(sum / float64(len(values))).DBm()
+	}
+
+	if n, ok := a.Percentile(); ok {
+		return percentile(values, n)
+	}
+	return math.NaN()
+}
+
+// Returns the n-th percentile of values, interpolating linearly between the
+// closest ranks. Sorts values.
+func percentile(values []float64, n float64) float64 {
+	sort.Float64s(values)
+	rank := n / 100 * float64(len(values)-1)
+	lower := int(math.Floor(rank))
+	upper := int(math.Ceil(rank))
+	return values[lower] + (values[upper]-values[lower])*(rank-float64(lower))
+}
+
+// Type PowerSample is a single sweep of the power measured in consecutive
+// frequency bins, starting from FreqMin in steps of FreqRes.
+type PowerSample struct {
+	// When the sweep was taken
+	Time time.Time `json:"time"`
+
+	// Power in dBm for each frequency bin
+	Bins []float64 `json:"bins"`
+}
+
+// Reference implementation of the aggregation requested by amr. Samples are
+// grouped in consecutive windows of TimeRes seconds starting at Begin (samples
+// outside of Begin and End are ignored), then each frequency bin is aggregated
+// separately within a window. The result has one sample per non-empty window,
+// with Time set to the start of the window. All samples in a window must have
+// the same number of bins.
+func (amr AggregatedMeasurementRequest) Aggregate(samples []PowerSample) ([]PowerSample, error) {
+	if amr.TimeRes <= 0 {
+		return nil, errors.New("TimeRes must be positive")
+	}
+	if err := amr.Aggregation.Validate(); err != nil {
+		return nil, fmt.Errorf("Aggregation: %w", err)
+	}
+
+	window := time.Duration(amr.TimeRes) * time.Second
+	windows := map[int64][]PowerSample{}
+	for _, s := range samples {
+		if s.Time.Before(amr.Begin) || !s.Time.Before(amr.End) {
+			continue
+		}
+		i := int64(s.Time.Sub(amr.Begin) / window)
+		windows[i] = append(windows[i], s)
+	}
+
+	indexes := make([]int64, 0, len(windows))
+	for i := range windows {
+		indexes = append(indexes, i)
+	}
+	sort.Slice(indexes, func(a, b int) bool {
+		return indexes[a] < indexes[b]
+	})
+
+	ret := make([]PowerSample, 0, len(indexes))
+	for _, i := range indexes {
+		group := windows[i]
+		bins := len(group[0].Bins)
+		for _, s := range group {
+			if len(s.Bins) != bins {
+				return nil, fmt.Errorf("sample at %v has %d bins, expected %d", s.Time, len(s.Bins), bins)
+			}
+		}
+		values := make([]float64, len(group))
+
+		out := PowerSample{
+			Time: amr.Begin.Add(time.Duration(i) * window),
+			Bins: make([]float64, bins),
+		}
+		for b := 0; b < bins; b++ {
+			for j, s := range group {
+				values[j] = s.Bins[b]
+			}
+			out.Bins[b] = amr.Aggregation.Apply(values)
+		}
+		ret = append(ret, out)
+	}
+
+	return ret, nil
+}
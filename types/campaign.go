@@ -0,0 +1,245 @@
+// Copyright (C) 2022 OpenRFSense
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Affero General Public License as
+// published by the Free Software Foundation, either version 3 of the
+// License, or (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU Affero General Public License for more details.
+//
+// You should have received a copy of the GNU Affero General Public License
+// along with this program.  If not, see <http://www.gnu.org/licenses/>.
+
+package types
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+	"time"
+)
+
+// Type CampaignState is the lifecycle state of a Campaign. It is encoded in JSON
+// as a string.
+type CampaignState string
+
+const (
+	// Created, waiting to be sent to the sensors.
+	CampaignPending CampaignState = "pending"
+	// Accepted by the sensors, waiting for Begin.
+	CampaignScheduled CampaignState = "scheduled"
+	// Measuring on at least one sensor.
+	CampaignRunning CampaignState = "running"
+	// All sensors finished measuring.
+	CampaignCompleted CampaignState = "completed"
+	// Stopped because of an error.
+	CampaignFailed CampaignState = "failed"
+	// Stopped on request.
+	CampaignCancelled CampaignState = "cancelled"
+)
+
+// States each state can move to. Terminal states have none.
+var campaignTransitions = map[CampaignState][]CampaignState{
+	CampaignPending:   {CampaignScheduled, CampaignFailed, CampaignCancelled},
+	CampaignScheduled: {CampaignRunning, CampaignFailed, CampaignCancelled},
+	CampaignRunning:   {CampaignCompleted, CampaignFailed, CampaignCancelled},
+	CampaignCompleted: {},
+	CampaignFailed:    {},
+	CampaignCancelled: {},
+}
+
+// Returned (wrapped) by Campaign.Transition for transitions which are not allowed.
+var ErrInvalidTransition = errors.New("invalid campaign state transition")
+
+// Returns true if the campaign cannot move to any other state.
+func (s CampaignState) Terminal() bool {
+	next, ok := campaignTransitions[s]
+	return ok && len(next) == 0
+}
+
+// Returns true if a campaign in state s can move to state to.
+func (s CampaignState) CanTransition(to CampaignState) bool {
+	for _, next := range campaignTransitions[s] {
+		if next == to {
+			return true
+		}
+	}
+	return false
+}
+
+// Validates the state.
+func (s CampaignState) Validate() error {
+	if _, ok := campaignTransitions[s]; !ok {
+		return ErrCampaignStateInvalid
+	}
+	return nil
+}
+
+// Type Transition records when a campaign entered a state.
+type Transition struct {
+	// The state entered
+	State CampaignState `json:"state"`
+
+	// When the state was entered in ISO 8601
+	Time time.Time `json:"time"`
+
+	// Why the state was entered, such as an error message
+	Reason string `json:"reason,omitempty"`
+}
+
+// Type SensorProgress is the progress of a campaign on a single sensor.
+type SensorProgress struct {
+	// Fraction of the measurement done, from 0 to 1
+	Progress float64 `json:"progress"`
+
+	// Last update in ISO 8601
+	UpdatedAt time.Time `json:"updatedAt"`
+
+	// Last error reported by the sensor, if any
+	Error string `json:"error,omitempty"`
+}
+
+// Type Campaign is a measurement campaign, as tracked by both the backend and the
+// nodes. Its state can only be changed with Transition, which enforces the
+// allowed transitions and records them in History. New instances are to be
+// created with types.NewCampaign().
+type Campaign struct {
+	// Campaign ID, as set in the CampaignId field of the request
+	Id string `json:"id"`
+
+	// Kind of measurement requested
+	Mode Mode `json:"mode"`
+
+	// Start time in ISO 8601
+	Begin time.Time `json:"begin"`
+
+	// End time in ISO 8601
+	End time.Time `json:"end"`
+
+	// Current state
+	State CampaignState `json:"state"`
+
+	// Every state entered, oldest first, starting with CampaignPending
+	History []Transition `json:"history"`
+
+	// Progress of each sensor, by hardware ID
+	Sensors map[string]SensorProgress `json:"sensors"`
+}
+
+// Creates a pending campaign with the given ID.
+func NewCampaign(id string) *Campaign {
+	return &Campaign{
+		Id:      id,
+		State:   CampaignPending,
+		History: []Transition{{State: CampaignPending, Time: time.Now()}},
+		Sensors: make(map[string]SensorProgress),
+	}
+}
+
+// Sets the kind of measurement requested.
+func (c *Campaign) WithMode(m Mode) *Campaign {
+	c.Mode = m
+	return c
+}
+
+// Sets the start and end times.
+func (c *Campaign) WithWindow(begin time.Time, end time.Time) *Campaign {
+	c.Begin = begin
+	c.End = end
+	return c
+}
+
+// Adds sensors to the campaign, with no progress. Sensors is allocated if nil, as
+// in a Campaign decoded from JSON without sensors.
+func (c *Campaign) WithSensors(sensors ...string) *Campaign {
+	if c.Sensors == nil {
+		c.Sensors = make(map[string]SensorProgress, len(sensors))
+	}
+	for _, s := range sensors {
+		if _, ok := c.Sensors[s]; !ok {
+			c.Sensors[s] = SensorProgress{}
+		}
+	}
+	return c
+}
+
+// Moves the campaign to state to, recording the current time and the reason.
+// Returns an error wrapping ErrInvalidTransition if the move is not allowed.
+func (c *Campaign) Transition(to CampaignState, reason string) error {
+	return c.TransitionAt(to, time.Now(), reason)
+}
+
+// Same as Transition, but records the given time, which cannot be earlier than
+// the last transition.
+func (c *Campaign) TransitionAt(to CampaignState, t time.Time, reason string) error {
+	if !c.State.CanTransition(to) {
+		return fmt.Errorf("%w: from %s to %s", ErrInvalidTransition, c.State, to)
+	}
+	if n := len(c.History); n > 0 && t.Before(c.History[n-1].Time) {
+		return fmt.Errorf("%w: %v is before the last transition", ErrInvalidTransition, t)
+	}
+
+	c.State = to
+	c.History = append(c.History, Transition{State: to, Time: t, Reason: reason})
+	return nil
+}
+
+// Returns when the campaign entered the state, and false if it never did.
+func (c *Campaign) EnteredAt(state CampaignState) (time.Time, bool) {
+	for _, t := range c.History {
+		if t.State == state {
+			return t.Time, true
+		}
+	}
+	return time.Time{}, false
+}
+
+// Records the progress (from 0 to 1) of a sensor, along with its last error if
+// not nil. Returns an error if the sensor is not part of the campaign, the
+// campaign is not running or progress is out of range.
+func (c *Campaign) UpdateProgress(sensor string, progress float64, err error) error {
+	if _, ok := c.Sensors[sensor]; !ok {
+		return fmt.Errorf("sensor %s is not part of campaign %s", sensor, c.Id)
+	}
+	if c.State != CampaignRunning {
+		return fmt.Errorf("campaign %s is %s, not running", c.Id, c.State)
+	}
+	if !(progress >= 0 && progress <= 1) {
+		return fmt.Errorf("progress %v out of range", progress)
+	}
+
+	p := SensorProgress{
+		Progress:  progress,
+		UpdatedAt: time.Now(),
+	}
+	if err != nil {
+		p.Error = err.Error()
+	}
+	c.Sensors[sensor] = p
+	return nil
+}
+
+// Returns the average progress of all sensors, from 0 to 1.
+func (c *Campaign) Completion() float64 {
+	if len(c.Sensors) == 0 {
+		return 0
+	}
+	sum := 0.0
+	for _, p := range c.Sensors {
+		sum += p.Progress
+	}
+	return sum / float64(len(c.Sensors))
+}
+
+// Returns the hardware IDs of the sensors, sorted.
+func (c *Campaign) SensorIds() []string {
+	ret := make([]string, 0, len(c.Sensors))
+	for s := range c.Sensors {
+		ret = append(ret, s)
+	}
+	sort.Strings(ret)
+	return ret
+}
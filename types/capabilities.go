@@ -0,0 +1,91 @@
+// Copyright (C) 2022 OpenRFSense
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Affero General Public License as
+// published by the Free Software Foundation, either version 3 of the
+// License, or (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU Affero General Public License for more details.
+//
+// You should have received a copy of the GNU Affero General Public License
+// along with this program.  If not, see <http://www.gnu.org/licenses/>.
+
+package types
+
+// Type Mode is a kind of measurement a sensor can perform. It is encoded in JSON
+// as a string.
+type Mode string
+
+const (
+	// Power sweeps, as requested by AggregatedMeasurementRequest.
+	ModeAggregated Mode = "aggregated"
+	// I/Q captures, as requested by RawMeasurementRequest.
+	ModeRaw Mode = "raw"
+)
+
+// Validates the mode.
+func (m Mode) Validate() error {
+	switch m {
+	case ModeAggregated, ModeRaw:
+		return nil
+	}
+	return ErrModeInvalid
+}
+
+// Type SensorCapabilities describes what the hardware of a sensor can do, as
+// published by the node. Requests can be checked against it with ValidateFor.
+type SensorCapabilities struct {
+	// Lowest tunable frequency in Hz
+	FreqMin Frequency `json:"freqMin"`
+
+	// Highest tunable frequency in Hz
+	FreqMax Frequency `json:"freqMax"`
+
+	// Highest sample rate in samples per second
+	MaxSampleRate int64 `json:"maxSampleRate"`
+
+	// Lowest gain in dB
+	GainMin float64 `json:"gainMin"`
+
+	// Highest gain in dB
+	GainMax float64 `json:"gainMax"`
+
+	// Whether automatic gain control is available
+	AGC bool `json:"agc"`
+
+	// Supported measurement modes
+	Modes []Mode `json:"modes"`
+
+	// Sample formats supported in raw measurements, any if empty
+	SampleFormats []SampleFormat `json:"sampleFormats,omitempty"`
+}
+
+// Returns true if the sensor supports the mode.
+func (c SensorCapabilities) Supports(m Mode) bool {
+	for _, mode := range c.Modes {
+		if mode == m {
+			return true
+		}
+	}
+	return false
+}
+
+// Returns true if the sensor supports the sample format. The empty format is
+// the same as SampleFormatCF32.
+func (c SensorCapabilities) SupportsFormat(f SampleFormat) bool {
+	if len(c.SampleFormats) == 0 {
+		return true
+	}
+	if f == "" {
+		f = SampleFormatCF32
+	}
+	for _, format := range c.SampleFormats {
+		if format == f {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,182 @@
+// Copyright (C) 2022 OpenRFSense
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Affero General Public License as
+// published by the Free Software Foundation, either version 3 of the
+// License, or (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU Affero General Public License for more details.
+//
+// You should have received a copy of the GNU Affero General Public License
+// along with this program.  If not, see <http://www.gnu.org/licenses/>.
+
+package types
+
+import (
+	"bytes"
+	"errors"
+	"net/http"
+	"sort"
+	"strings"
+	"text/template"
+
+	v "github.com/go-ozzo/ozzo-validation/v4"
+)
+
+// Codes of the errors built by NewAPIErrorFrom, to be used for APIError.Code.
+const (
+	// The request failed validation, see the details.
+	CodeValidationFailed = "validation_failed"
+	// The server failed in an unexpected way.
+	CodeInternal = "internal_error"
+	// Code of field errors which do not carry one.
+	CodeInvalid = "validation_invalid"
+)
+
+// Type FieldError describes why a single field of a request is invalid.
+type FieldError struct {
+	// Location of the field as a JSON pointer (RFC 6901) into the request, such
+	// as "/sensors/0"
+	Field string `json:"field"`
+
+	// Machine-readable code, such as "validation_required"
+	Code string `json:"code"`
+
+	// Human-readable message, in English unless translated
+	Message string `json:"message"`
+
+	// Values substituted in the message, to be used when translating it
+	Params map[string]interface{} `json:"params,omitempty"`
+}
+
+// Type APIError is the body of every error response of the API. New instances
+// are to be created with types.NewAPIError() or types.NewAPIErrorFrom().
+type APIError struct {
+	// HTTP status code of the response
+	Status int `json:"status"`
+
+	// Machine-readable code, such as "validation_failed"
+	Code string `json:"code"`
+
+	// Human-readable message
+	Message string `json:"message"`
+
+	// Errors for each invalid field, sorted by field
+	Details []FieldError `json:"details,omitempty"`
+}
+
+// Creates an APIError without details.
+func NewAPIError(status int, code string, message string) *APIError {
+	return &APIError{
+		Status:  status,
+		Code:    code,
+		Message: message,
+	}
+}
+
+// Creates the APIError describing err, or returns nil if err is nil:
+//   - an *APIError is returned as is
+//   - validation.Errors, as returned by the Validate methods, become a 400 Bad
+//     Request with one FieldError for each invalid field, nested ones included
+//   - a validation.Error (such as ErrModeUnsupported) becomes a 400 Bad Request
+//     with its own code and message
+//   - anything else, validation.InternalError included, becomes a 500 Internal
+//     Server Error, without exposing the original message
+func NewAPIErrorFrom(err error) *APIError {
+	if err == nil {
+		return nil
+	}
+
+	apiErr := &APIError{}
+	if errors.As(err, &apiErr) {
+		return apiErr
+	}
+
+	internal := v.InternalError(nil)
+	if errors.As(err, &internal) {
+		return NewAPIError(http.StatusInternalServerError, CodeInternal, "internal error")
+	}
+
+	errs := v.Errors{}
+	if errors.As(err, &errs) {
+		ret := NewAPIError(http.StatusBadRequest, CodeValidationFailed, "request validation failed")
+		ret.Details = appendFieldErrors(nil, "", errs)
+		sort.Slice(ret.Details, func(i, j int) bool {
+			return ret.Details[i].Field < ret.Details[j].Field
+		})
+		return ret
+	}
+
+	verr := v.Error(nil)
+	if errors.As(err, &verr) {
+		return NewAPIError(http.StatusBadRequest, verr.Code(), verr.Error())
+	}
+
+	return NewAPIError(http.StatusInternalServerError, CodeInternal, "internal error")
+}
+
+// Returns the message.
+func (e *APIError) Error() string {
+	return e.Message
+}
+
+// Returns a copy of the error with the messages of the details replaced by the
+// translations found by code. Translations are templates which can use the
+// params of the detail, such as "deve essere al massimo {{.max}}". Details
+// without a translation are left untouched.
+func (e *APIError) Translate(translations map[string]string) *APIError {
+	ret := *e
+	ret.Details = make([]FieldError, len(e.Details))
+	for i, d := range e.Details {
+		if t, ok := translations[d.Code]; ok {
+			d.Message = render(t, d.Params)
+		}
+		ret.Details[i] = d
+	}
+	if t, ok := translations[e.Code]; ok {
+		ret.Message = t
+	}
+	return &ret
+}
+
+// Appends a FieldError for each error in errs, whose fields are under path.
+func appendFieldErrors(details []FieldError, path string, errs v.Errors) []FieldError {
+	for field, err := range errs {
+		pointer := path + "/" + strings.NewReplacer("~", "~0", "/", "~1").Replace(field)
+
+		nested := v.Errors{}
+		if errors.As(err, &nested) {
+			details = appendFieldErrors(details, pointer, nested)
+			continue
+		}
+
+		detail := FieldError{
+			Field:   pointer,
+			Code:    CodeInvalid,
+			Message: err.Error(),
+		}
+		verr := v.Error(nil)
+		if errors.As(err, &verr) {
+			detail.Code = verr.Code()
+			detail.Params = verr.Params()
+		}
+		details = append(details, detail)
+	}
+	return details
+}
+
+// Renders a message template with params, returning it as is if invalid.
+func render(message string, params map[string]interface{}) string {
+	tmpl, err := template.New("message").Parse(message)
+	if err != nil {
+		return message
+	}
+	buf := bytes.Buffer{}
+	if err := tmpl.Execute(&buf, params); err != nil {
+		return message
+	}
+	return buf.String()
+}
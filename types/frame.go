@@ -0,0 +1,267 @@
+// Copyright (C) 2022 OpenRFSense
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Affero General Public License as
+// published by the Free Software Foundation, either version 3 of the
+// License, or (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU Affero General Public License for more details.
+//
+// You should have received a copy of the GNU Affero General Public License
+// along with this program.  If not, see <http://www.gnu.org/licenses/>.
+
+package types
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"time"
+)
+
+// Binary spectrum frames are laid out as follows, with every integer in big
+// endian order:
+//
+//	magic       4 bytes  "ORSF"
+//	version     uint8    FrameVersion
+//	encoding    uint8    FrameEncoding of the body
+//	campaignLen uint8    length of the campaign ID
+//	sensorLen   uint8    length of the sensor ID
+//	time        int64    Unix time in nanoseconds
+//	freqStart   int64    Hz
+//	freqStep    int64    Hz
+//	binCount    uint32   number of bins in the body
+//	campaignId  campaignLen bytes
+//	sensorId    sensorLen bytes
+//	body        binCount float32 or int16 values
+const (
+	// Version of the binary frame format written by this package.
+	FrameVersion = 1
+
+	// Maximum number of bins in a binary frame, to bound memory use when decoding.
+	MaxFrameBins = 1 << 20
+
+	// Resolution in dB of EncodingInt16 bins, which can represent power between
+	// -327.67 and 327.67 dBm.
+	QuantizationStep = 0.01
+
+	frameMagic      = "ORSF"
+	frameHeaderSize = 36
+	maxFrameID      = math.MaxUint8
+	// Stored in EncodingInt16 bodies for NaN bins.
+	int16NaN = math.MinInt16
+)
+
+// Returned (wrapped) when decoding malformed binary frames.
+var ErrInvalidFrame = errors.New("invalid spectrum frame")
+
+// Type FrameEncoding is the representation of power bins in a binary frame.
+type FrameEncoding uint8
+
+const (
+	// Bins as IEEE 754 single precision floats, 4 bytes each.
+	EncodingFloat32 FrameEncoding = iota
+	// Bins quantized to QuantizationStep as signed 16 bit integers, 2 bytes each.
+	// Values out of range are clamped.
+	EncodingInt16
+)
+
+// Returns the size in bytes of a single bin, or 0 for unknown encodings.
+func (e FrameEncoding) binSize() int {
+	switch e {
+	case EncodingFloat32:
+		return 4
+	case EncodingInt16:
+		return 2
+	}
+	return 0
+}
+
+// Appends the binary encoding of f to buf, with bins encoded as enc. Returns an
+// error if the frame cannot be represented (IDs longer than 255 bytes, more than
+// MaxFrameBins bins or a time out of the int64 nanoseconds range).
+func AppendFrame(buf []byte, f SpectrumFrame, enc FrameEncoding) ([]byte, error) {
+	size := enc.binSize()
+	switch {
+	case size == 0:
+		return buf, fmt.Errorf("unknown frame encoding %d", enc)
+	case len(f.CampaignId) > maxFrameID:
+		return buf, fmt.Errorf("campaign ID longer than %d bytes", maxFrameID)
+	case len(f.SensorId) > maxFrameID:
+		return buf, fmt.Errorf("sensor ID longer than %d bytes", maxFrameID)
+	case len(f.Bins) > MaxFrameBins:
+		return buf, fmt.Errorf("more than %d bins", MaxFrameBins)
+	}
+	nanos := f.Time.UnixNano()
+	if !time.Unix(0, nanos).Equal(f.Time) {
+		return buf, fmt.Errorf("time %v out of range", f.Time)
+	}
+
+	buf = append(buf, frameMagic...)
+	buf = append(buf, FrameVersion, byte(enc), byte(len(f.CampaignId)), byte(len(f.SensorId)))
+	buf = binary.BigEndian.AppendUint64(buf, uint64(nanos))
+	buf = binary.BigEndian.AppendUint64(buf, uint64(f.FreqStart))
+	buf = binary.BigEndian.AppendUint64(buf, uint64(f.FreqStep))
+	buf = binary.BigEndian.AppendUint32(buf, uint32(len(f.Bins)))
+	buf = append(buf, f.CampaignId...)
+	buf = append(buf, f.SensorId...)
+
+	for _, b := range f.Bins {
+		if enc == EncodingFloat32 {
+			buf = binary.BigEndian.AppendUint32(buf, math.Float32bits(float32(b)))
+		} else {
+			buf = binary.BigEndian.AppendUint16(buf, uint16(quantize(b)))
+		}
+	}
+	return buf, nil
+}
+
+// Returns the binary encoding of the frame with EncodingFloat32 bins.
+func (f SpectrumFrame) MarshalBinary() ([]byte, error) {
+	return AppendFrame(nil, f, EncodingFloat32)
+}
+
+// Decodes a single binary frame, with either encoding. The time is returned in UTC.
+func (f *SpectrumFrame) UnmarshalBinary(data []byte) error {
+	r := bytes.NewReader(data)
+	frame, err := readFrame(r)
+	if errors.Is(err, io.EOF) || errors.Is(err, io.ErrUnexpectedEOF) {
+		return fmt.Errorf("%w: truncated", ErrInvalidFrame)
+	}
+	if err != nil {
+		return err
+	}
+	if r.Len() > 0 {
+		return fmt.Errorf("%w: %d trailing bytes", ErrInvalidFrame, r.Len())
+	}
+	*f = frame
+	return nil
+}
+
+// Quantizes a dBm value for EncodingInt16.
+func quantize(dbm float64) int16 {
+	if math.IsNaN(dbm) {
+		return int16NaN
+	}
+	q := math.Round(dbm / QuantizationStep)
+	return int16(math.Max(-math.MaxInt16, math.Min(math.MaxInt16, q)))
+}
+
+// Reverses quantize.
+func dequantize(q int16) float64 {
+	if q == int16NaN {
+		return math.NaN()
+	}
+	return float64(q) * QuantizationStep
+}
+
+// Reads a single frame from r. Returns io.EOF if r ends before the frame starts,
+// io.ErrUnexpectedEOF if it ends in the middle of it.
+func readFrame(r io.Reader) (SpectrumFrame, error) {
+	header := [frameHeaderSize]byte{}
+	if _, err := io.ReadFull(r, header[:]); err != nil {
+		return SpectrumFrame{}, err
+	}
+	if string(header[:4]) != frameMagic {
+		return SpectrumFrame{}, fmt.Errorf("%w: bad magic %q", ErrInvalidFrame, header[:4])
+	}
+	if header[4] != FrameVersion {
+		return SpectrumFrame{}, fmt.Errorf("%w: unsupported version %d", ErrInvalidFrame, header[4])
+	}
+	enc := FrameEncoding(header[5])
+	size := enc.binSize()
+	if size == 0 {
+		return SpectrumFrame{}, fmt.Errorf("%w: unknown encoding %d", ErrInvalidFrame, enc)
+	}
+	count := binary.BigEndian.Uint32(header[32:])
+	if count > MaxFrameBins {
+		return SpectrumFrame{}, fmt.Errorf("%w: %d bins exceed the maximum of %d", ErrInvalidFrame, count, MaxFrameBins)
+	}
+
+	ids := make([]byte, int(header[6])+int(header[7]))
+	body := make([]byte, int(count)*size)
+	for _, part := range [][]byte{ids, body} {
+		if _, err := io.ReadFull(r, part); err != nil {
+			if err == io.EOF {
+				err = io.ErrUnexpectedEOF
+			}
+			return SpectrumFrame{}, err
+		}
+	}
+
+	f := SpectrumFrame{
+		CampaignId: string(ids[:header[6]]),
+		SensorId:   string(ids[header[6]:]),
+		Time:       time.Unix(0, int64(binary.BigEndian.Uint64(header[8:]))).UTC(),
+		FreqStart:  Frequency(binary.BigEndian.Uint64(header[16:])),
+		FreqStep:   Frequency(binary.BigEndian.Uint64(header[24:])),
+		Bins:       make([]float64, count),
+	}
+	for i := range f.Bins {
+		if enc == EncodingFloat32 {
+			f.Bins[i] = float64(math.Float32frombits(binary.BigEndian.Uint32(body[i*4:])))
+		} else {
+			f.Bins[i] = dequantize(int16(binary.BigEndian.Uint16(body[i*2:])))
+		}
+	}
+	return f, nil
+}
+
+// Type FrameWriter writes a stream of binary spectrum frames, one after the
+// other. New instances are to be created with types.NewFrameWriter().
+type FrameWriter struct {
+	w   io.Writer
+	enc FrameEncoding
+	buf []byte
+}
+
+// Creates a FrameWriter writing to w, with EncodingFloat32 bins by default.
+func NewFrameWriter(w io.Writer) *FrameWriter {
+	return &FrameWriter{
+		w:   w,
+		enc: EncodingFloat32,
+	}
+}
+
+// Sets the encoding of the bins of every following frame.
+func (fw *FrameWriter) WithEncoding(enc FrameEncoding) *FrameWriter {
+	fw.enc = enc
+	return fw
+}
+
+// Encodes f and writes it to the underlying writer.
+func (fw *FrameWriter) Write(f SpectrumFrame) error {
+	buf, err := AppendFrame(fw.buf[:0], f, fw.enc)
+	if err != nil {
+		return err
+	}
+	fw.buf = buf
+	_, err = fw.w.Write(buf)
+	return err
+}
+
+// Type FrameReader reads a stream of binary spectrum frames, such as one written
+// by FrameWriter. New instances are to be created with types.NewFrameReader().
+type FrameReader struct {
+	r io.Reader
+}
+
+// Creates a FrameReader reading from r. r should be buffered, as frames are read
+// in a few small reads.
+func NewFrameReader(r io.Reader) *FrameReader {
+	return &FrameReader{
+		r: r,
+	}
+}
+
+// Reads the next frame. Returns io.EOF once the stream ends between two frames,
+// io.ErrUnexpectedEOF if it ends in the middle of a frame.
+func (fr *FrameReader) Read() (SpectrumFrame, error) {
+	return readFrame(fr.r)
+}
@@ -0,0 +1,56 @@
+// Copyright (C) 2022 OpenRFSense
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Affero General Public License as
+// published by the Free Software Foundation, either version 3 of the
+// License, or (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU Affero General Public License for more details.
+//
+// You should have received a copy of the GNU Affero General Public License
+// along with this program.  If not, see <http://www.gnu.org/licenses/>.
+
+package types
+
+import "time"
+
+// Type ValidationPolicy holds limits set by the backend on measurement requests,
+// on top of the rules always enforced by Validate. A zero limit means unlimited.
+// New instances are to be created with types.NewValidationPolicy().
+type ValidationPolicy struct {
+	// Widest frequency span in Hz: FreqMax - FreqMin for aggregated requests,
+	// SampleRate for raw ones
+	MaxSpan Frequency
+
+	// Longest time between Begin and End
+	MaxDuration time.Duration
+
+	// Highest number of sensors in a single request
+	MaxSensors int
+}
+
+// Creates a ValidationPolicy without limits.
+func NewValidationPolicy() *ValidationPolicy {
+	return &ValidationPolicy{}
+}
+
+// Sets the widest frequency span.
+func (p *ValidationPolicy) WithMaxSpan(span Frequency) *ValidationPolicy {
+	p.MaxSpan = span
+	return p
+}
+
+// Sets the longest time between Begin and End.
+func (p *ValidationPolicy) WithMaxDuration(d time.Duration) *ValidationPolicy {
+	p.MaxDuration = d
+	return p
+}
+
+// Sets the highest number of sensors in a single request.
+func (p *ValidationPolicy) WithMaxSensors(n int) *ValidationPolicy {
+	p.MaxSensors = n
+	return p
+}
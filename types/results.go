@@ -0,0 +1,89 @@
+// Copyright (C) 2022 OpenRFSense
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Affero General Public License as
+// published by the Free Software Foundation, either version 3 of the
+// License, or (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU Affero General Public License for more details.
+//
+// You should have received a copy of the GNU Affero General Public License
+// along with this program.  If not, see <http://www.gnu.org/licenses/>.
+
+package types
+
+import "time"
+
+// Type SpectrumFrame is a single power sweep returned by a sensor for an
+// AggregatedMeasurementRequest: Bins[i] is the power measured around
+// FreqStart + i*FreqStep.
+type SpectrumFrame struct {
+	// Hardware ID of the sensor which took the measurement
+	SensorId string `json:"sensorId"`
+
+	// Campaign ID of the request being fulfilled
+	CampaignId string `json:"campaignId"`
+
+	// Time of the sweep in ISO 8601
+	Time time.Time `json:"time"`
+
+	// Frequency of the first bin in Hz
+	FreqStart Frequency `json:"freqStart"`
+
+	// Distance between consecutive bins in Hz
+	FreqStep Frequency `json:"freqStep"`
+
+	// Power in dBm for each frequency bin
+	Bins []float64 `json:"bins"`
+}
+
+// Returns the frequency just past the last bin, in Hz.
+func (f SpectrumFrame) FreqEnd() Frequency {
+	return f.FreqStart.Add(f.FreqStep.Mul(int64(len(f.Bins))))
+}
+
+// Returns the frame as a sample to be passed to AggregatedMeasurementRequest.Aggregate.
+func (f SpectrumFrame) PowerSample() PowerSample {
+	return PowerSample{
+		Time: f.Time,
+		Bins: f.Bins,
+	}
+}
+
+// Type IQBlock is a block of raw samples returned by a sensor for a
+// RawMeasurementRequest.
+type IQBlock struct {
+	// Hardware ID of the sensor which took the measurement
+	SensorId string `json:"sensorId"`
+
+	// Campaign ID of the request being fulfilled
+	CampaignId string `json:"campaignId"`
+
+	// Time of the first sample in ISO 8601
+	Time time.Time `json:"time"`
+
+	// Center frequency in Hz
+	FreqCenter Frequency `json:"freqCenter"`
+
+	// Sample rate in samples per second
+	SampleRate int64 `json:"sampleRate"`
+
+	// Interleaved I/Q samples: I0, Q0, I1, Q1, ...
+	Samples []float32 `json:"samples"`
+}
+
+// Returns the number of complex samples in the block.
+func (b IQBlock) Len() int {
+	return len(b.Samples) / 2
+}
+
+// Returns the time span covered by the block.
+func (b IQBlock) Duration() time.Duration {
+	if b.SampleRate <= 0 {
+		return 0
+	}
+	return time.Duration(int64(b.Len()) * int64(time.Second) / b.SampleRate)
+}
@@ -0,0 +1,62 @@
+// Copyright (C) 2022 OpenRFSense
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Affero General Public License as
+// published by the Free Software Foundation, either version 3 of the
+// License, or (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU Affero General Public License for more details.
+//
+// You should have received a copy of the GNU Affero General Public License
+// along with this program.  If not, see <http://www.gnu.org/licenses/>.
+
+package types
+
+const (
+	// Highest sample rate accepted in a RawMeasurementRequest, in samples per second.
+	MaxSampleRate = 250e6
+
+	// Highest gain accepted in a RawMeasurementRequest, in dB.
+	MaxGain = 100
+)
+
+// Type SampleFormat is the representation of the I/Q samples of a raw
+// measurement, named after the SoapySDR stream formats. It is encoded in JSON as
+// a string.
+type SampleFormat string
+
+const (
+	// Complex 32 bit floats. The default.
+	SampleFormatCF32 SampleFormat = "cf32"
+	// Complex signed 16 bit integers.
+	SampleFormatCS16 SampleFormat = "cs16"
+	// Complex signed 8 bit integers.
+	SampleFormatCS8 SampleFormat = "cs8"
+	// Complex unsigned 8 bit integers, as produced by RTL-SDR dongles.
+	SampleFormatCU8 SampleFormat = "cu8"
+)
+
+// Returns the size in bytes of a single complex sample, or 0 if the format is
+// invalid.
+func (f SampleFormat) Size() int {
+	switch f {
+	case "", SampleFormatCF32:
+		return 8
+	case SampleFormatCS16:
+		return 4
+	case SampleFormatCS8, SampleFormatCU8:
+		return 2
+	}
+	return 0
+}
+
+// Validates the sample format. The empty value is valid and means SampleFormatCF32.
+func (f SampleFormat) Validate() error {
+	if f.Size() == 0 {
+		return ErrSampleFormatInvalid
+	}
+	return nil
+}
@@ -0,0 +1,703 @@
+// Copyright (C) 2022 OpenRFSense
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Affero General Public License as
+// published by the Free Software Foundation, either version 3 of the
+// License, or (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU Affero General Public License for more details.
+//
+// You should have received a copy of the GNU Affero General Public License
+// along with this program.  If not, see <http://www.gnu.org/licenses/>.
+
+package types
+
+import (
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	v "github.com/go-ozzo/ozzo-validation/v4"
+)
+
+const (
+	// Number of windows checked for overlaps by Schedule.Validate.
+	overlapCheckWindows = 1000
+
+	// Number of consecutive periods without occurrences after which a recurrence
+	// rule gives up, bounding the work done for rules which never match (such as
+	// "FREQ=MINUTELY;INTERVAL=2;BYMINUTE=1" starting on an even minute).
+	maxEmptyPeriods = 100000
+)
+
+// Type Schedule describes recurring measurement windows, such as every night
+// from 01:00 to 03:00. Windows start at the occurrences of either a cron
+// expression or an RFC 5545 recurrence rule, evaluated in TimeZone, and last
+// Duration seconds. New instances are to be created with types.NewCronSchedule()
+// or types.NewRRuleSchedule().
+type Schedule struct {
+	// Standard 5 field cron expression (minute, hour, day of month, month, day of
+	// week), such as "0 1 * * *", or one of @yearly, @monthly, @weekly, @daily and
+	// @hourly
+	Cron string `json:"cron,omitempty"`
+
+	// RFC 5545 recurrence rule, such as "FREQ=DAILY;BYHOUR=1;BYMINUTE=0". The
+	// FREQ, INTERVAL, COUNT, UNTIL, BYMONTH, BYMONTHDAY, BYDAY (without
+	// ordinals), BYHOUR and BYMINUTE parts are supported
+	RRule string `json:"rrule,omitempty"`
+
+	// First possible window start in ISO 8601. Required for RRule, which uses it
+	// as DTSTART
+	Start time.Time `json:"start"`
+
+	// No window starts at or after this time if not zero, in ISO 8601
+	Until time.Time `json:"until"`
+
+	// Duration of each window in seconds
+	Duration int64 `json:"duration"`
+
+	// IANA name of the time zone the schedule is evaluated in, defaults to UTC
+	TimeZone string `json:"timeZone,omitempty"`
+}
+
+// Type Window is a single occurrence of a Schedule.
+type Window struct {
+	// Start time in ISO 8601
+	Begin time.Time `json:"begin"`
+
+	// End time in ISO 8601
+	End time.Time `json:"end"`
+}
+
+// Creates a schedule of windows of the given duration, starting at the
+// occurrences of the cron expression.
+func NewCronSchedule(expr string, duration time.Duration) *Schedule {
+	return &Schedule{
+		Cron:     expr,
+		Duration: int64(duration / time.Second),
+	}
+}
+
+// Creates a schedule of windows of the given duration, starting at the
+// occurrences of the recurrence rule from start.
+func NewRRuleSchedule(rule string, start time.Time, duration time.Duration) *Schedule {
+	return &Schedule{
+		RRule:    rule,
+		Start:    start,
+		Duration: int64(duration / time.Second),
+	}
+}
+
+// Sets the first possible window start.
+func (s *Schedule) WithStart(start time.Time) *Schedule {
+	s.Start = start
+	return s
+}
+
+// Sets the time at or after which no window starts.
+func (s *Schedule) WithUntil(until time.Time) *Schedule {
+	s.Until = until
+	return s
+}
+
+// Sets the IANA name of the time zone the schedule is evaluated in.
+func (s *Schedule) WithTimeZone(name string) *Schedule {
+	s.TimeZone = name
+	return s
+}
+
+// Returns the location named by TimeZone.
+func (s Schedule) location() (*time.Location, error) {
+	if s.TimeZone == "" {
+		return time.UTC, nil
+	}
+	return time.LoadLocation(s.TimeZone)
+}
+
+// Returns an iterator over the windows which have not ended at from, in order.
+// Window times are in the schedule time zone. Returns an error if the schedule
+// cannot be parsed.
+func (s Schedule) Windows(from time.Time) (*WindowIterator, error) {
+	loc, err := s.location()
+	if err != nil {
+		return nil, err
+	}
+
+	it := &WindowIterator{
+		from:     from,
+		until:    s.Until,
+		duration: time.Duration(s.Duration) * time.Second,
+	}
+
+	switch {
+	case s.Cron != "" && s.RRule != "":
+		return nil, fmt.Errorf("only one of cron and rrule can be set")
+	case s.Cron != "":
+		c, err := parseCron(s.Cron)
+		if err != nil {
+			return nil, err
+		}
+		lower := from.Add(-it.duration)
+		if lower.Before(s.Start) {
+			lower = s.Start
+		}
+		it.next = c.iterate(lower.Add(-time.Nanosecond), loc)
+	case s.RRule != "":
+		if s.Start.IsZero() {
+			return nil, fmt.Errorf("rrule requires a start time")
+		}
+		r, err := parseRRule(s.RRule, loc)
+		if err != nil {
+			return nil, err
+		}
+		it.next = r.iterate(s.Start.In(loc), from.Add(-it.duration))
+	default:
+		return nil, fmt.Errorf("one of cron and rrule must be set")
+	}
+	return it, nil
+}
+
+// Returns error if there are no windows from Start (or now if zero), reported on
+// the cron expression or recurrence rule, or if two of the first windows overlap,
+// reported on the duration.
+func (s Schedule) checkWindows() error {
+	from := s.Start
+	if from.IsZero() {
+		from = time.Now()
+	}
+	it, err := s.Windows(from)
+	if err != nil {
+		return err
+	}
+
+	prev, ok := it.Next()
+	if !ok {
+		if s.RRule != "" {
+			return v.Errors{"rrule": ErrScheduleNoWindows}
+		}
+		return v.Errors{"cron": ErrScheduleNoWindows}
+	}
+	for i := 1; i < overlapCheckWindows; i++ {
+		next, more := it.Next()
+		if !more {
+			break
+		}
+		if next.Begin.Before(prev.End) {
+			return v.Errors{"duration": ErrScheduleOverlap.SetParams(map[string]interface{}{"first": prev.Begin, "second": next.Begin})}
+		}
+		prev = next
+	}
+	return nil
+}
+
+// Type WindowIterator yields the windows of a Schedule, as returned by
+// Schedule.Windows.
+type WindowIterator struct {
+	next     func() (time.Time, bool)
+	from     time.Time
+	until    time.Time
+	duration time.Duration
+}
+
+// Returns the next window, or false once there are no more.
+func (it *WindowIterator) Next() (Window, bool) {
+	for {
+		begin, ok := it.next()
+		if !ok || (!it.until.IsZero() && !begin.Before(it.until)) {
+			it.next = func() (time.Time, bool) { return time.Time{}, false }
+			return Window{}, false
+		}
+		w := Window{Begin: begin, End: begin.Add(it.duration)}
+		if w.End.After(it.from) {
+			return w, true
+		}
+	}
+}
+
+// Returns up to n of the next windows.
+func (it *WindowIterator) Take(n int) []Window {
+	ret := []Window{}
+	for len(ret) < n {
+		w, ok := it.Next()
+		if !ok {
+			break
+		}
+		ret = append(ret, w)
+	}
+	return ret
+}
+
+// Set of small integers, such as minutes or months.
+type bitset uint64
+
+func (b bitset) has(i int) bool {
+	return i >= 0 && i < 64 && b&(1<<uint(i)) != 0
+}
+
+// Type cron is a parsed cron expression.
+type cron struct {
+	minute, hour, dom, month, dow bitset
+	// Whether the day fields are restricted, as days match if either does
+	domRestricted, dowRestricted bool
+}
+
+var cronDescriptors = map[string]string{
+	"@yearly":   "0 0 1 1 *",
+	"@annually": "0 0 1 1 *",
+	"@monthly":  "0 0 1 * *",
+	"@weekly":   "0 0 * * 0",
+	"@daily":    "0 0 * * *",
+	"@midnight": "0 0 * * *",
+	"@hourly":   "0 * * * *",
+}
+
+var (
+	monthNames = []string{"", "JAN", "FEB", "MAR", "APR", "MAY", "JUN", "JUL", "AUG", "SEP", "OCT", "NOV", "DEC"}
+	dayNames   = []string{"SUN", "MON", "TUE", "WED", "THU", "FRI", "SAT"}
+)
+
+// Parses a standard 5 field cron expression.
+func parseCron(expr string) (*cron, error) {
+	if d, ok := cronDescriptors[strings.ToLower(strings.TrimSpace(expr))]; ok {
+		expr = d
+	}
+	fields := strings.Fields(expr)
+	if len(fields) != 5 {
+		return nil, fmt.Errorf("cron expression must have 5 fields, got %d", len(fields))
+	}
+
+	c := &cron{}
+	var err error
+	if c.minute, err = parseCronField(fields[0], 0, 59, nil); err != nil {
+		return nil, fmt.Errorf("minute: %w", err)
+	}
+	if c.hour, err = parseCronField(fields[1], 0, 23, nil); err != nil {
+		return nil, fmt.Errorf("hour: %w", err)
+	}
+	if c.dom, err = parseCronField(fields[2], 1, 31, nil); err != nil {
+		return nil, fmt.Errorf("day of month: %w", err)
+	}
+	if c.month, err = parseCronField(fields[3], 1, 12, monthNames); err != nil {
+		return nil, fmt.Errorf("month: %w", err)
+	}
+	// 7 is also Sunday
+	if c.dow, err = parseCronField(fields[4], 0, 7, dayNames); err != nil {
+		return nil, fmt.Errorf("day of week: %w", err)
+	}
+	if c.dow.has(7) {
+		c.dow |= 1
+	}
+	c.domRestricted = !strings.HasPrefix(fields[2], "*")
+	c.dowRestricted = !strings.HasPrefix(fields[4], "*")
+	return c, nil
+}
+
+// Parses a comma separated list of values, ranges ("1-5") and steps ("*/15",
+// "1-30/2" or "5/10") between min and max. names, if not nil, are accepted as
+// aliases of their index.
+func parseCronField(field string, min int, max int, names []string) (bitset, error) {
+	value := func(s string) (int, error) {
+		for i, name := range names {
+			if name != "" && strings.EqualFold(s, name) {
+				return i, nil
+			}
+		}
+		n, err := strconv.Atoi(s)
+		if err != nil || n < min || n > max {
+			return 0, fmt.Errorf("invalid value %q", s)
+		}
+		return n, nil
+	}
+
+	ret := bitset(0)
+	for _, part := range strings.Split(field, ",") {
+		rng, step, hasStep := strings.Cut(part, "/")
+		inc := 1
+		if hasStep {
+			n, err := strconv.Atoi(step)
+			if err != nil || n <= 0 {
+				return 0, fmt.Errorf("invalid step %q", step)
+			}
+			inc = n
+		}
+
+		lo, hi := min, max
+		if rng != "*" {
+			a, b, isRange := strings.Cut(rng, "-")
+			var err error
+			if lo, err = value(a); err != nil {
+				return 0, err
+			}
+			hi = lo
+			if isRange {
+				if hi, err = value(b); err != nil {
+					return 0, err
+				}
+			} else if hasStep {
+				hi = max
+			}
+			if lo > hi {
+				return 0, fmt.Errorf("invalid range %q", rng)
+			}
+		}
+
+		for i := lo; i <= hi; i += inc {
+			ret |= 1 << uint(i)
+		}
+	}
+	return ret, nil
+}
+
+// Returns true if the day of t matches the day fields.
+func (c *cron) dayMatches(t time.Time) bool {
+	dom, dow := c.dom.has(t.Day()), c.dow.has(int(t.Weekday()))
+	if c.domRestricted && c.dowRestricted {
+		return dom || dow
+	}
+	return dom && dow
+}
+
+// Returns the first occurrence strictly after t, in loc. Gives up after 5 years
+// without occurrences (such as for "0 0 30 2 *").
+func (c *cron) next(t time.Time, loc *time.Location) (time.Time, bool) {
+	t = t.In(loc)
+	t = time.Date(t.Year(), t.Month(), t.Day(), t.Hour(), t.Minute()+1, 0, 0, loc)
+	limit := t.Year() + 5
+	for t.Year() <= limit {
+		switch {
+		case !c.month.has(int(t.Month())):
+			t = time.Date(t.Year(), t.Month()+1, 1, 0, 0, 0, 0, loc)
+		case !c.dayMatches(t):
+			t = time.Date(t.Year(), t.Month(), t.Day()+1, 0, 0, 0, 0, loc)
+		case !c.hour.has(t.Hour()):
+			t = time.Date(t.Year(), t.Month(), t.Day(), t.Hour()+1, 0, 0, 0, loc)
+		case !c.minute.has(t.Minute()):
+			t = time.Date(t.Year(), t.Month(), t.Day(), t.Hour(), t.Minute()+1, 0, 0, loc)
+		default:
+			return t, true
+		}
+	}
+	return time.Time{}, false
+}
+
+// Returns a function yielding the occurrences strictly after t, in order.
+func (c *cron) iterate(t time.Time, loc *time.Location) func() (time.Time, bool) {
+	return func() (time.Time, bool) {
+		next, ok := c.next(t, loc)
+		if ok {
+			t = next
+		}
+		return next, ok
+	}
+}
+
+// Type rrule is a parsed RFC 5545 recurrence rule.
+type rrule struct {
+	freq     string
+	interval int
+	count    int
+	until    time.Time
+
+	byMonth, byHour, byMinute bitset
+	byDay                     bitset
+	byMonthDay                []int
+}
+
+// Supported values of FREQ.
+var rruleFreqs = map[string]bool{
+	"YEARLY": true, "MONTHLY": true, "WEEKLY": true, "DAILY": true, "HOURLY": true, "MINUTELY": true,
+}
+
+// Parses a recurrence rule. A floating UNTIL is interpreted in loc.
+func parseRRule(rule string, loc *time.Location) (*rrule, error) {
+	r := &rrule{interval: 1}
+	rule = strings.TrimPrefix(strings.TrimSpace(rule), "RRULE:")
+
+	for _, part := range strings.Split(rule, ";") {
+		name, value, ok := strings.Cut(part, "=")
+		if !ok {
+			return nil, fmt.Errorf("invalid rule part %q", part)
+		}
+
+		var err error
+		switch strings.ToUpper(name) {
+		case "FREQ":
+			r.freq = strings.ToUpper(value)
+			if !rruleFreqs[r.freq] {
+				err = fmt.Errorf("unsupported frequency %q", value)
+			}
+		case "INTERVAL":
+			r.interval, err = strconv.Atoi(value)
+			if err == nil && r.interval <= 0 {
+				err = fmt.Errorf("must be positive")
+			}
+		case "COUNT":
+			r.count, err = strconv.Atoi(value)
+			if err == nil && r.count <= 0 {
+				err = fmt.Errorf("must be positive")
+			}
+		case "UNTIL":
+			r.until, err = parseRRuleTime(value, loc)
+		case "BYMONTH":
+			r.byMonth, err = parseCronField(value, 1, 12, nil)
+		case "BYHOUR":
+			r.byHour, err = parseCronField(value, 0, 23, nil)
+		case "BYMINUTE":
+			r.byMinute, err = parseCronField(value, 0, 59, nil)
+		case "BYDAY":
+			r.byDay, err = parseCronField(value, 0, 6, []string{"SU", "MO", "TU", "WE", "TH", "FR", "SA"})
+		case "BYMONTHDAY":
+			for _, s := range strings.Split(value, ",") {
+				n, convErr := strconv.Atoi(s)
+				if convErr != nil || n == 0 || n < -31 || n > 31 {
+					err = fmt.Errorf("invalid value %q", s)
+					break
+				}
+				r.byMonthDay = append(r.byMonthDay, n)
+			}
+		default:
+			err = fmt.Errorf("not supported")
+		}
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", strings.ToUpper(name), err)
+		}
+	}
+
+	switch {
+	case r.freq == "":
+		return nil, fmt.Errorf("FREQ is required")
+	case r.count > 0 && !r.until.IsZero():
+		return nil, fmt.Errorf("COUNT and UNTIL cannot both be set")
+	}
+	return r, nil
+}
+
+// Parses an RFC 5545 date or date-time, such as "20220601" or "20220601T120000Z".
+func parseRRuleTime(value string, loc *time.Location) (time.Time, error) {
+	for _, layout := range []string{"20060102T150405Z", "20060102T150405", "20060102"} {
+		tz := loc
+		if strings.HasSuffix(layout, "Z") {
+			tz = time.UTC
+		}
+		if t, err := time.ParseInLocation(layout, value, tz); err == nil {
+			return t, nil
+		}
+	}
+	return time.Time{}, fmt.Errorf("invalid time %q", value)
+}
+
+// Returns the start of the n-th period after the one containing start.
+func (r *rrule) periodStart(start time.Time, n int) time.Time {
+	y, m, d := start.Date()
+	loc := start.Location()
+	step := n * r.interval
+	switch r.freq {
+	case "YEARLY":
+		return time.Date(y+step, 1, 1, 0, 0, 0, 0, loc)
+	case "MONTHLY":
+		return time.Date(y, m+time.Month(step), 1, 0, 0, 0, 0, loc)
+	case "WEEKLY":
+		// Weeks start on Monday
+		monday := d - (int(start.Weekday())+6)%7
+		return time.Date(y, m, monday+7*step, 0, 0, 0, 0, loc)
+	case "DAILY":
+		return time.Date(y, m, d+step, 0, 0, 0, 0, loc)
+	case "HOURLY":
+		return time.Date(y, m, d, start.Hour(), 0, 0, 0, loc).Add(time.Duration(step) * time.Hour)
+	default:
+		return time.Date(y, m, d, start.Hour(), start.Minute(), 0, 0, loc).Add(time.Duration(step) * time.Minute)
+	}
+}
+
+// Returns the length of a period of HOURLY and MINUTELY rules.
+func (r *rrule) step() time.Duration {
+	if r.freq == "HOURLY" {
+		return time.Duration(r.interval) * time.Hour
+	}
+	return time.Duration(r.interval) * time.Minute
+}
+
+// Returns the index of the first period starting at or after t, for HOURLY and
+// MINUTELY rules.
+func (r *rrule) periodAt(start time.Time, t time.Time) int {
+	step := r.step()
+	return int((t.Sub(r.periodStart(start, 0)) + step - 1) / step)
+}
+
+// Returns the index of the period containing t, which must not be before start.
+func (r *rrule) periodContaining(start time.Time, t time.Time) int {
+	// Days since the epoch of the date of t, ignoring DST changes
+	days := func(t time.Time) int {
+		y, m, d := t.Date()
+		return int(time.Date(y, m, d, 0, 0, 0, 0, time.UTC).Unix() / 86400)
+	}
+
+	t = t.In(start.Location())
+	n := 0
+	switch r.freq {
+	case "YEARLY":
+		n = t.Year() - start.Year()
+	case "MONTHLY":
+		n = (t.Year()-start.Year())*12 + int(t.Month()) - int(start.Month())
+	case "WEEKLY":
+		n = (days(t) - days(r.periodStart(start, 0))) / 7
+	case "DAILY":
+		n = days(t) - days(start)
+	default:
+		return int(t.Sub(r.periodStart(start, 0)) / r.step())
+	}
+	return n / r.interval
+}
+
+// Returns true if the day of t matches the BYMONTH, BYMONTHDAY and BYDAY parts,
+// or the day of start where RFC 5545 defaults to it.
+func (r *rrule) dayMatches(t time.Time, start time.Time) bool {
+	if r.byMonth != 0 {
+		if !r.byMonth.has(int(t.Month())) {
+			return false
+		}
+	} else if r.freq == "YEARLY" && r.byMonthDay == nil && r.byDay == 0 && t.Month() != start.Month() {
+		return false
+	}
+
+	if r.byMonthDay != nil {
+		days := time.Date(t.Year(), t.Month()+1, 0, 0, 0, 0, 0, time.UTC).Day()
+		found := false
+		for _, d := range r.byMonthDay {
+			if d == t.Day() || (d < 0 && days+1+d == t.Day()) {
+				found = true
+			}
+		}
+		if !found {
+			return false
+		}
+	} else if (r.freq == "YEARLY" || r.freq == "MONTHLY") && r.byDay == 0 && t.Day() != start.Day() {
+		return false
+	}
+
+	if r.byDay != 0 {
+		return r.byDay.has(int(t.Weekday()))
+	}
+	return r.freq != "WEEKLY" || t.Weekday() == start.Weekday()
+}
+
+// Returns the occurrences in the period starting at ps, not before start, sorted.
+func (r *rrule) expand(ps time.Time, start time.Time) []time.Time {
+	loc := start.Location()
+	days := 1
+	switch r.freq {
+	case "YEARLY":
+		days = time.Date(ps.Year(), 12, 31, 0, 0, 0, 0, time.UTC).YearDay()
+	case "MONTHLY":
+		days = time.Date(ps.Year(), ps.Month()+1, 0, 0, 0, 0, 0, time.UTC).Day()
+	case "WEEKLY":
+		days = 7
+	}
+
+	// Values of a time part: the period's own for the frequency of the part (if
+	// allowed by the BY part), otherwise the BY part or the start's.
+	values := func(by bitset, own int, isOwn bool, def int, max int) []int {
+		if isOwn {
+			if by == 0 || by.has(own) {
+				return []int{own}
+			}
+			return nil
+		}
+		if by == 0 {
+			return []int{def}
+		}
+		ret := []int{}
+		for i := 0; i <= max; i++ {
+			if by.has(i) {
+				ret = append(ret, i)
+			}
+		}
+		return ret
+	}
+	hours := values(r.byHour, ps.Hour(), r.freq == "HOURLY" || r.freq == "MINUTELY", start.Hour(), 23)
+	minutes := values(r.byMinute, ps.Minute(), r.freq == "MINUTELY", start.Minute(), 59)
+
+	ret := []time.Time{}
+	y, m, d := ps.Date()
+	for i := 0; i < days; i++ {
+		day := time.Date(y, m, d+i, 12, 0, 0, 0, loc)
+		if !r.dayMatches(day, start) {
+			continue
+		}
+		for _, h := range hours {
+			for _, min := range minutes {
+				t := time.Date(day.Year(), day.Month(), day.Day(), h, min, start.Second(), 0, loc)
+				if r.freq == "HOURLY" || r.freq == "MINUTELY" {
+					// Keep the absolute hour of the period on DST changes
+					t = ps.Add(time.Duration(min-ps.Minute())*time.Minute + time.Duration(start.Second())*time.Second)
+				}
+				// Skip times which do not exist because of DST changes
+				if t.Hour() != h || t.Minute() != min || t.Day() != day.Day() {
+					continue
+				}
+				if !t.Before(start) {
+					ret = append(ret, t)
+				}
+			}
+		}
+	}
+	sort.Slice(ret, func(i, j int) bool {
+		return ret[i].Before(ret[j])
+	})
+	return ret
+}
+
+// Returns a function yielding the occurrences from start, in order. Without
+// COUNT, iteration starts from the period containing from, as earlier
+// occurrences are not needed. Gives up after 10 years or maxEmptyPeriods periods
+// without occurrences. HOURLY and MINUTELY periods on days which do not match
+// are skipped a day at a time.
+func (r *rrule) iterate(start time.Time, from time.Time) func() (time.Time, bool) {
+	period, emitted, empty := 0, 0, 0
+	pending := []time.Time{}
+	last := start
+	done := false
+	subDaily := r.freq == "HOURLY" || r.freq == "MINUTELY"
+
+	if r.count == 0 && from.After(start) {
+		period = r.periodContaining(start, from)
+		last = from
+	}
+
+	return func() (time.Time, bool) {
+		for !done && len(pending) == 0 {
+			ps := r.periodStart(start, period)
+			period++
+			if ps.After(last.AddDate(10, 0, 0)) || (!r.until.IsZero() && ps.After(r.until)) || empty >= maxEmptyPeriods {
+				done = true
+				break
+			}
+			if subDaily && !r.dayMatches(ps, start) {
+				y, m, d := ps.Date()
+				period = r.periodAt(start, time.Date(y, m, d+1, 0, 0, 0, 0, ps.Location()))
+				continue
+			}
+			pending = r.expand(ps, start)
+			empty++
+		}
+		empty = 0
+		if done {
+			return time.Time{}, false
+		}
+
+		t := pending[0]
+		pending = pending[1:]
+		emitted++
+		if (r.count > 0 && emitted > r.count) || (!r.until.IsZero() && t.After(r.until)) {
+			done = true
+			return time.Time{}, false
+		}
+		last = t
+		return t, true
+	}
+}
@@ -15,7 +15,10 @@
 
 package types
 
-import "time"
+import (
+	"encoding/json"
+	"time"
+)
 
 // Type AggregatedMeasurementRequest describes a HTTP request for a measurement
 // campaign on multiple sensors, where the results are averaged over the specified
@@ -31,13 +34,13 @@ type AggregatedMeasurementRequest struct {
 	End time.Time `json:"end"`
 
 	// Lower bound for frequency in Hz
-	FreqMin int64 `json:"freqMin"`
+	FreqMin Frequency `json:"freqMin"`
 
 	// Upper bound for frequency in Hz
-	FreqMax int64 `json:"freqMax"`
+	FreqMax Frequency `json:"freqMax"`
 
 	// Frequency resolution in Hz
-	FreqRes int64 `json:"freqRes"`
+	FreqRes Frequency `json:"freqRes"`
 
 	// Time resolution in seconds
 	TimeRes int64 `json:"timeRes"`
@@ -45,7 +48,9 @@ type AggregatedMeasurementRequest struct {
 	// Campaign ID. For internal use only, will be ignored if not null
 	CampaignId string `json:"campaignId"`
 
-	// AggregationFunc? (defaults to AVG/average)
+	// Function used to aggregate each frequency bin over TimeRes, defaults to
+	// AggregationAvg if empty
+	Aggregation Aggregation `json:"aggregation,omitempty"`
 }
 
 // Type RawMeasurementRequest describes a HTTP request for a measurement
@@ -55,8 +60,24 @@ type RawMeasurementRequest struct {
 	// List of sensor hardware IDs to run the measurement campaign on
 	Sensors []string `json:"sensors"`
 
-	// Center frequency for measurement
-	FreqCenter int64
+	// Center frequency for measurement in Hz
+	FreqCenter Frequency `json:"freqCenter"`
+
+	// Sample rate in samples per second
+	SampleRate int64 `json:"sampleRate"`
+
+	// Analog filter bandwidth in Hz, defaults to the sample rate if zero
+	Bandwidth Frequency `json:"bandwidth,omitempty"`
+
+	// Receiver gain in dB, must be zero if AGC is set
+	Gain float64 `json:"gain,omitempty"`
+
+	// Use automatic gain control instead of a fixed gain
+	AGC bool `json:"agc,omitempty"`
+
+	// Format of the samples as stored by the sensor, defaults to SampleFormatCF32
+	// if empty
+	SampleFormat SampleFormat `json:"sampleFormat,omitempty"`
 
 	// Start time in ISO 8601
 	Begin time.Time `json:"begin"`
@@ -67,3 +88,27 @@ type RawMeasurementRequest struct {
 	// Campaign ID. For internal use only, will be ignored if not null
 	CampaignId string `json:"campaignId"`
 }
+
+// Decodes the request, also accepting the center frequency under the legacy
+// "FreqCenter" key used before the field had a JSON tag. If both keys are
+// present, "freqCenter" wins.
+func (rmr *RawMeasurementRequest) UnmarshalJSON(data []byte) error {
+	type plain RawMeasurementRequest
+	req := struct {
+		plain
+		LegacyFreqCenter *Frequency `json:"FreqCenter"`
+		FreqCenter       *Frequency `json:"freqCenter"`
+	}{}
+	if err := json.Unmarshal(data, &req); err != nil {
+		return err
+	}
+
+	*rmr = RawMeasurementRequest(req.plain)
+	switch {
+	case req.FreqCenter != nil:
+		rmr.FreqCenter = *req.FreqCenter
+	case req.LegacyFreqCenter != nil:
+		rmr.FreqCenter = *req.LegacyFreqCenter
+	}
+	return nil
+}
@@ -16,14 +16,25 @@
 package types
 
 import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"reflect"
+	"strings"
 	"testing"
 	"time"
+
+	v "github.com/go-ozzo/ozzo-validation/v4"
 )
 
 func TestValidateAggregatedMeasurementRequest(t *testing.T) {
 	t.Run("valid measurement request", func(t *testing.T) {
 		now := time.Now()
 		amr := AggregatedMeasurementRequest{
+			Sensors: []string{"sensor"},
 			Begin:   now.Add(-time.Minute),
 			End:     now,
 			FreqMin: 10e8,   // 100MHz
@@ -41,6 +52,7 @@ func TestValidateAggregatedMeasurementRequest(t *testing.T) {
 	t.Run("begin > end", func(t *testing.T) {
 		now := time.Now()
 		amr := AggregatedMeasurementRequest{
+			Sensors: []string{"sensor"},
 			Begin:   now,
 			End:     now.Add(-time.Minute),
 			FreqMin: 18e8,   // 180MHz
@@ -58,6 +70,7 @@ func TestValidateAggregatedMeasurementRequest(t *testing.T) {
 	t.Run("freqMin > freqMax", func(t *testing.T) {
 		now := time.Now()
 		amr := AggregatedMeasurementRequest{
+			Sensors: []string{"sensor"},
 			Begin:   now.Add(-time.Minute),
 			End:     now,
 			FreqMin: 18e8,   // 180MHz
@@ -75,6 +88,7 @@ func TestValidateAggregatedMeasurementRequest(t *testing.T) {
 	t.Run("freqRes too high (freqMax - freqMin)", func(t *testing.T) {
 		now := time.Now()
 		amr := AggregatedMeasurementRequest{
+			Sensors: []string{"sensor"},
 			Begin:   now.Add(-time.Minute),
 			End:     now,
 			FreqMin: 10e8, // 100MHz
@@ -90,14 +104,118 @@ func TestValidateAggregatedMeasurementRequest(t *testing.T) {
 	})
 }
 
+func TestValidationPolicy(t *testing.T) {
+	begin := time.Date(2022, 6, 1, 12, 0, 0, 0, time.UTC)
+	valid := func() AggregatedMeasurementRequest {
+		return AggregatedMeasurementRequest{
+			Sensors: []string{"a", "b"},
+			Begin:   begin,
+			End:     begin.Add(time.Hour),
+			FreqMin: 10e8,
+			FreqMax: 11e8,
+			FreqRes: 1e5,
+			TimeRes: 60,
+		}
+	}
+
+	t.Run("error codes", func(t *testing.T) {
+		cases := []struct {
+			name   string
+			modify func(amr *AggregatedMeasurementRequest)
+			field  string
+			code   string
+		}{
+			{"no sensors", func(amr *AggregatedMeasurementRequest) { amr.Sensors = nil }, "sensors", "validation_required"},
+			{"empty sensor", func(amr *AggregatedMeasurementRequest) { amr.Sensors = []string{""} }, "sensors/0", "validation_required"},
+			{"begin == end", func(amr *AggregatedMeasurementRequest) { amr.End = amr.Begin }, "begin", ErrBeginNotBefore.Code()},
+			{"timeRes too long", func(amr *AggregatedMeasurementRequest) { amr.TimeRes = 3601 }, "timeRes", ErrTimeResTooLong.Code()},
+			{"freqRes not divisor", func(amr *AggregatedMeasurementRequest) { amr.FreqRes = 3e5 }, "freqRes", ErrFreqResNotDivisor.Code()},
+		}
+		for _, c := range cases {
+			t.Run(c.name, func(t *testing.T) {
+				amr := valid()
+				c.modify(&amr)
+				if code := errorCode(t, amr.Validate(), c.field); code != c.code {
+					t.Fatalf("expected %s, got %s", c.code, code)
+				}
+			})
+		}
+	})
+
+	t.Run("limits", func(t *testing.T) {
+		p := NewValidationPolicy().WithMaxSpan(1e8).WithMaxDuration(time.Hour).WithMaxSensors(2)
+		amr := valid()
+		if err := amr.ValidateWith(p); err != nil {
+			t.Fatal(err)
+		}
+
+		amr.FreqMax += 1e5
+		amr.End = amr.End.Add(time.Second)
+		amr.Sensors = append(amr.Sensors, "c")
+		err := amr.ValidateWith(p)
+		for field, exp := range map[string]v.Error{"freqMax": ErrSpanTooWide, "end": ErrDurationTooLong, "sensors": ErrTooManySensors} {
+			if code := errorCode(t, err, field); code != exp.Code() {
+				t.Fatalf("expected %s, got %s", exp.Code(), code)
+			}
+		}
+		if msg := err.(v.Errors)["end"].Error(); msg != "must be no more than 1h0m0s after Begin" {
+			t.Fatalf("unexpected message %q", msg)
+		}
+
+		if err := amr.ValidateWith(nil); err != nil {
+			t.Fatal(err)
+		}
+
+		rmr := RawMeasurementRequest{
+			Sensors:    []string{"a"},
+			Begin:      begin,
+			End:        begin.Add(time.Hour),
+			FreqCenter: 10e8,
+			SampleRate: 2e8,
+		}
+		if code := errorCode(t, rmr.ValidateWith(p), "sampleRate"); code != ErrSpanTooWide.Code() {
+			t.Fatalf("expected %s, got %s", ErrSpanTooWide.Code(), code)
+		}
+	})
+}
+
+// Returns the code of the validation error for the given field, a slash-separated
+// path for nested errors such as "sensors/0", failing if there is none.
+func errorCode(t *testing.T, err error, field string) string {
+	t.Helper()
+	for _, key := range strings.Split(field, "/") {
+		errs, ok := err.(v.Errors)
+		if !ok {
+			t.Fatalf("expected validation.Errors, got %v", err)
+		}
+		if err, ok = errs[key]; !ok {
+			t.Fatalf("expected an error for %s, got %v", field, errs)
+		}
+	}
+	verr, ok := err.(v.Error)
+	if !ok {
+		t.Fatalf("expected validation.Error for %s, got %v", field, err)
+	}
+	return verr.Code()
+}
+
 func TestValidateRawMeasurementRequest(t *testing.T) {
-	t.Run("valid measurement request", func(t *testing.T) {
+	valid := func() RawMeasurementRequest {
 		now := time.Now()
-		rmr := RawMeasurementRequest{
+		return RawMeasurementRequest{
+			Sensors:    []string{"sensor"},
 			Begin:      now.Add(-time.Minute),
 			End:        now,
-			FreqCenter: -1,
+			FreqCenter: 10e8,  // 100MHz
+			SampleRate: 2.4e6, // 2.4MS/s
 		}
+	}
+
+	t.Run("valid measurement request", func(t *testing.T) {
+		rmr := valid()
+		rmr.Bandwidth = 2e6
+		rmr.Gain = 40
+		rmr.SampleFormat = SampleFormatCU8
 
 		err := rmr.Validate()
 		if err != nil {
@@ -106,12 +224,8 @@ func TestValidateRawMeasurementRequest(t *testing.T) {
 	})
 
 	t.Run("begin > end", func(t *testing.T) {
-		now := time.Now()
-		rmr := RawMeasurementRequest{
-			Begin:      now,
-			End:        now.Add(-time.Minute),
-			FreqCenter: -1,
-		}
+		rmr := valid()
+		rmr.Begin, rmr.End = rmr.End, rmr.Begin
 
 		err := rmr.Validate()
 		if err == nil {
@@ -120,16 +234,1152 @@ func TestValidateRawMeasurementRequest(t *testing.T) {
 	})
 
 	t.Run("invalid freqCenter", func(t *testing.T) {
+		rmr := valid()
+		rmr.FreqCenter = -1
+
+		err := rmr.Validate()
+		if err == nil {
+			t.Fatalf("freqCenter (%d) must not be negative", rmr.FreqCenter)
+		}
+	})
+
+	t.Run("invalid acquisition parameters", func(t *testing.T) {
+		invalid := map[string]func(rmr *RawMeasurementRequest){
+			"no sample rate":       func(rmr *RawMeasurementRequest) { rmr.SampleRate = 0 },
+			"sample rate too high": func(rmr *RawMeasurementRequest) { rmr.SampleRate = MaxSampleRate + 1 },
+			"bandwidth too high":   func(rmr *RawMeasurementRequest) { rmr.Bandwidth = Frequency(rmr.SampleRate) + 1 },
+			"negative gain":        func(rmr *RawMeasurementRequest) { rmr.Gain = -1 },
+			"gain too high":        func(rmr *RawMeasurementRequest) { rmr.Gain = MaxGain + 1 },
+			"gain with agc":        func(rmr *RawMeasurementRequest) { rmr.Gain, rmr.AGC = 10, true },
+			"unknown format":       func(rmr *RawMeasurementRequest) { rmr.SampleFormat = "cf64" },
+		}
+		for name, modify := range invalid {
+			rmr := valid()
+			modify(&rmr)
+			if err := rmr.Validate(); err == nil {
+				t.Fatalf("expected an error for %s", name)
+			}
+		}
+
+		rmr := valid()
+		rmr.AGC = true
+		if err := rmr.Validate(); err != nil {
+			t.Fatal(err)
+		}
+	})
+
+	t.Run("json", func(t *testing.T) {
+		rmr := valid()
+		rmr.Begin, rmr.End = time.Time{}, time.Time{}
+		rmr.AGC = true
+		raw, err := json.Marshal(rmr)
+		if err != nil {
+			t.Fatal(err)
+		}
+		exp := `{"sensors":["sensor"],"freqCenter":1000000000,"sampleRate":2400000,"agc":true,"begin":"0001-01-01T00:00:00Z","end":"0001-01-01T00:00:00Z","campaignId":""}`
+		if string(raw) != exp {
+			t.Fatalf("expected %s, got %s", exp, raw)
+		}
+
+		got := RawMeasurementRequest{}
+		if err := json.Unmarshal(raw, &got); err != nil {
+			t.Fatal(err)
+		}
+		if !reflect.DeepEqual(got, rmr) {
+			t.Fatalf("expected %+v, got %+v", rmr, got)
+		}
+	})
+
+	t.Run("legacy freqCenter key", func(t *testing.T) {
+		got := RawMeasurementRequest{}
+		if err := json.Unmarshal([]byte(`{"FreqCenter":1000,"sampleRate":10}`), &got); err != nil {
+			t.Fatal(err)
+		}
+		if got.FreqCenter != 1000 || got.SampleRate != 10 {
+			t.Fatalf("expected 1000 and 10, got %d and %d", got.FreqCenter, got.SampleRate)
+		}
+
+		for _, raw := range []string{`{"FreqCenter":1000,"freqCenter":2000}`, `{"freqCenter":2000,"FreqCenter":1000}`} {
+			got := RawMeasurementRequest{}
+			if err := json.Unmarshal([]byte(raw), &got); err != nil {
+				t.Fatal(err)
+			}
+			if got.FreqCenter != 2000 {
+				t.Fatalf("expected 2000, got %d", got.FreqCenter)
+			}
+		}
+	})
+}
+
+func TestAggregation(t *testing.T) {
+	t.Run("validation", func(t *testing.T) {
 		now := time.Now()
-		rmr := RawMeasurementRequest{
-			Begin:      now,
-			End:        now.Add(-time.Minute),
-			FreqCenter: -1,
+		amr := AggregatedMeasurementRequest{
+			Sensors: []string{"sensor"},
+			Begin:   now.Add(-time.Minute),
+			End:     now,
+			FreqMin: 10e8,   // 100MHz
+			FreqMax: 16e8,   // 160Mhz
+			FreqRes: 100000, // 100kHz
+			TimeRes: 30,     // 30 seconds
 		}
 
-		err := rmr.Validate()
+		for _, a := range []Aggregation{"", AggregationAvg, AggregationMin, AggregationMax, AggregationMedian, AggregationRMS, Percentile(95), "p99.9", "p0"} {
+			amr.Aggregation = a
+			if err := amr.Validate(); err != nil {
+				t.Fatalf("expected aggregation '%s' to be valid: %v", a, err)
+			}
+		}
+
+		for _, a := range []Aggregation{"average", "p", "p101", "p-1", "pNaN", "P50"} {
+			amr.Aggregation = a
+			if err := amr.Validate(); err == nil {
+				t.Fatalf("expected aggregation '%s' to be invalid", a)
+			}
+		}
+	})
+
+	t.Run("json", func(t *testing.T) {
+		amr := AggregatedMeasurementRequest{Aggregation: Percentile(95)}
+		raw, err := json.Marshal(amr)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !strings.Contains(string(raw), `"aggregation":"p95"`) {
+			t.Fatalf("expected aggregation to be encoded as 'p95', got %s", raw)
+		}
+
+		out := AggregatedMeasurementRequest{}
+		err = json.Unmarshal([]byte(`{"aggregation":"rms"}`), &out)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if out.Aggregation != AggregationRMS {
+			t.Fatalf("expected rms, got '%s'", out.Aggregation)
+		}
+	})
+
+	t.Run("functions", func(t *testing.T) {
+		values := []float64{-70, -80, -60, -90}
+		tests := map[Aggregation]float64{
+			"":                -75,
+			AggregationAvg:    -75,
+			AggregationMin:    -90,
+			AggregationMax:    -60,
+			AggregationMedian: -75,
+			Percentile(0):     -90,
+			Percentile(100):   -60,
+			Percentile(25):    -82.5,
+			AggregationRMS:    10 * math.Log10((1e-7+1e-8+1e-6+1e-9)/4),
+		}
+		for a, exp := range tests {
+			got := a.Apply(append([]float64(nil), values...))
+			if math.Abs(got-exp) > 1e-9 {
+				t.Errorf("expected %s to give %v, got %v", a, exp, got)
+			}
+		}
+
+		if !math.IsNaN(AggregationAvg.Apply(nil)) {
+			t.Error("expected NaN for no values")
+		}
+	})
+
+	t.Run("time series", func(t *testing.T) {
+		begin := time.Date(2022, 6, 1, 12, 0, 0, 0, time.UTC)
+		amr := AggregatedMeasurementRequest{
+			Begin:       begin,
+			End:         begin.Add(time.Minute),
+			TimeRes:     30,
+			Aggregation: AggregationMax,
+		}
+		samples := []PowerSample{
+			{Time: begin.Add(-time.Second), Bins: []float64{0, 0}},
+			{Time: begin, Bins: []float64{-80, -70}},
+			{Time: begin.Add(10 * time.Second), Bins: []float64{-60, -90}},
+			{Time: begin.Add(45 * time.Second), Bins: []float64{-50, -40}},
+			{Time: begin.Add(time.Minute), Bins: []float64{0, 0}},
+		}
+
+		got, err := amr.Aggregate(samples)
+		if err != nil {
+			t.Fatal(err)
+		}
+		exp := []PowerSample{
+			{Time: begin, Bins: []float64{-60, -70}},
+			{Time: begin.Add(30 * time.Second), Bins: []float64{-50, -40}},
+		}
+		if !reflect.DeepEqual(got, exp) {
+			t.Fatalf("expected %+v, got %+v", exp, got)
+		}
+
+		samples[2].Bins = []float64{-60}
+		_, err = amr.Aggregate(samples)
 		if err == nil {
-			t.Fatalf("begin (%v) must be later than end (%v)", rmr.Begin, rmr.End)
+			t.Fatal("expected an error for mismatched bin counts")
+		}
+	})
+}
+
+func TestResults(t *testing.T) {
+	begin := time.Date(2022, 6, 1, 12, 0, 0, 0, time.UTC)
+	amr := AggregatedMeasurementRequest{
+		Sensors:    []string{"a", "b"},
+		Begin:      begin,
+		End:        begin.Add(time.Minute),
+		FreqMin:    10e8,
+		FreqMax:    10e8 + 4e5,
+		FreqRes:    1e5,
+		TimeRes:    30,
+		CampaignId: "campaign",
+	}
+	frame := func() SpectrumFrame {
+		return SpectrumFrame{
+			SensorId:   "a",
+			CampaignId: "campaign",
+			Time:       begin.Add(time.Second),
+			FreqStart:  10e8,
+			FreqStep:   1e5,
+			Bins:       []float64{-90, -80, -70, -60},
+		}
+	}
+
+	t.Run("spectrum frame", func(t *testing.T) {
+		f := frame()
+		if err := amr.ValidateFrame(f); err != nil {
+			t.Fatal(err)
+		}
+		if f.FreqEnd() != amr.FreqMax {
+			t.Fatalf("expected %d, got %d", amr.FreqMax, f.FreqEnd())
+		}
+		if s := f.PowerSample(); !s.Time.Equal(f.Time) || !reflect.DeepEqual(s.Bins, f.Bins) {
+			t.Fatalf("expected %+v, got %+v", f, s)
+		}
+
+		invalid := map[string]func(f *SpectrumFrame){
+			"no bins":        func(f *SpectrumFrame) { f.Bins = nil },
+			"zero step":      func(f *SpectrumFrame) { f.FreqStep = 0 },
+			"other sensor":   func(f *SpectrumFrame) { f.SensorId = "c" },
+			"other campaign": func(f *SpectrumFrame) { f.CampaignId = "other" },
+			"before begin":   func(f *SpectrumFrame) { f.Time = begin.Add(-time.Second) },
+			"at end":         func(f *SpectrumFrame) { f.Time = amr.End },
+			"other start":    func(f *SpectrumFrame) { f.FreqStart += 1e5 },
+			"other step":     func(f *SpectrumFrame) { f.FreqStep = 2e5 },
+			"too few bins":   func(f *SpectrumFrame) { f.Bins = f.Bins[:3] },
+		}
+		for name, modify := range invalid {
+			f := frame()
+			modify(&f)
+			if err := amr.ValidateFrame(f); err == nil {
+				t.Fatalf("expected an error for %s", name)
+			}
+		}
+	})
+
+	t.Run("iq block", func(t *testing.T) {
+		rmr := RawMeasurementRequest{
+			Sensors:    []string{"a"},
+			Begin:      begin,
+			End:        begin.Add(time.Minute),
+			FreqCenter: 10e8,
+			SampleRate: 2,
+		}
+		b := IQBlock{
+			SensorId:   "a",
+			CampaignId: "campaign",
+			Time:       begin,
+			FreqCenter: 10e8,
+			SampleRate: 2,
+			Samples:    []float32{1, 0, 0, 1, -1, 0, 0, -1},
+		}
+		if err := rmr.ValidateBlock(b); err != nil {
+			t.Fatal(err)
+		}
+		if b.Len() != 4 || b.Duration() != 2*time.Second {
+			t.Fatalf("expected 4 samples over 2s, got %d over %v", b.Len(), b.Duration())
+		}
+
+		b.Samples = b.Samples[:3]
+		if err := b.Validate(); err == nil {
+			t.Fatal("expected an error for an odd number of values")
+		}
+		b.Samples = []float32{1, 0}
+		b.FreqCenter = 11e8
+		if err := rmr.ValidateBlock(b); err == nil {
+			t.Fatal("expected an error for a different center frequency")
+		}
+	})
+
+	t.Run("json", func(t *testing.T) {
+		raw, err := json.Marshal(frame())
+		if err != nil {
+			t.Fatal(err)
+		}
+		exp := `{"sensorId":"a","campaignId":"campaign","time":"2022-06-01T12:00:01Z","freqStart":1000000000,"freqStep":100000,"bins":[-90,-80,-70,-60]}`
+		if string(raw) != exp {
+			t.Fatalf("expected %s, got %s", exp, raw)
+		}
+
+		got := SpectrumFrame{}
+		if err := json.Unmarshal(raw, &got); err != nil {
+			t.Fatal(err)
+		}
+		if !reflect.DeepEqual(got, frame()) {
+			t.Fatalf("expected %+v, got %+v", frame(), got)
+		}
+	})
+}
+
+func TestFrameBinary(t *testing.T) {
+	frame := SpectrumFrame{
+		SensorId:   "sensor",
+		CampaignId: "campaign",
+		Time:       time.Date(2022, 6, 1, 12, 0, 0, 123456789, time.UTC),
+		FreqStart:  10e8,
+		FreqStep:   1e5,
+		Bins:       []float64{-90.5, -80.25, math.NaN(), 0, 12.75},
+	}
+
+	t.Run("float32", func(t *testing.T) {
+		raw, err := frame.MarshalBinary()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(raw) != 36+len("sensor")+len("campaign")+4*len(frame.Bins) {
+			t.Fatalf("unexpected length %d", len(raw))
+		}
+
+		got := SpectrumFrame{}
+		if err := got.UnmarshalBinary(raw); err != nil {
+			t.Fatal(err)
+		}
+		if !equalFrames(got, frame, 0) {
+			t.Fatalf("expected %+v, got %+v", frame, got)
+		}
+	})
+
+	t.Run("int16", func(t *testing.T) {
+		f := frame
+		f.Bins = append([]float64{-90.123, -1000, 1000}, f.Bins...)
+		raw, err := AppendFrame(nil, f, EncodingInt16)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		got := SpectrumFrame{}
+		if err := got.UnmarshalBinary(raw); err != nil {
+			t.Fatal(err)
+		}
+		f.Bins[1], f.Bins[2] = -327.67, 327.67
+		if !equalFrames(got, f, QuantizationStep/2) {
+			t.Fatalf("expected %+v, got %+v", f, got)
+		}
+	})
+
+	t.Run("stream", func(t *testing.T) {
+		buf := bytes.Buffer{}
+		w := NewFrameWriter(&buf).WithEncoding(EncodingInt16)
+		for i := 0; i < 3; i++ {
+			f := frame
+			f.FreqStart += Frequency(i)
+			if err := w.Write(f); err != nil {
+				t.Fatal(err)
+			}
+		}
+
+		r := NewFrameReader(&buf)
+		for i := 0; i < 3; i++ {
+			f, err := r.Read()
+			if err != nil {
+				t.Fatal(err)
+			}
+			if f.FreqStart != frame.FreqStart+Frequency(i) {
+				t.Fatalf("expected %d, got %d", frame.FreqStart+Frequency(i), f.FreqStart)
+			}
+		}
+		if _, err := r.Read(); err != io.EOF {
+			t.Fatalf("expected io.EOF, got %v", err)
+		}
+
+		raw, _ := frame.MarshalBinary()
+		r = NewFrameReader(bytes.NewReader(raw[:len(raw)-1]))
+		if _, err := r.Read(); err != io.ErrUnexpectedEOF {
+			t.Fatalf("expected io.ErrUnexpectedEOF, got %v", err)
+		}
+	})
+
+	t.Run("invalid", func(t *testing.T) {
+		raw, _ := frame.MarshalBinary()
+		corrupt := map[string]func(b []byte) []byte{
+			"magic":     func(b []byte) []byte { b[0] = 'X'; return b },
+			"version":   func(b []byte) []byte { b[4] = 2; return b },
+			"encoding":  func(b []byte) []byte { b[5] = 9; return b },
+			"bin count": func(b []byte) []byte { b[32] = 0xff; return b },
+			"truncated": func(b []byte) []byte { return b[:10] },
+			"trailing":  func(b []byte) []byte { return append(b, 0) },
+		}
+		for name, modify := range corrupt {
+			f := SpectrumFrame{}
+			err := f.UnmarshalBinary(modify(append([]byte(nil), raw...)))
+			if !errors.Is(err, ErrInvalidFrame) {
+				t.Fatalf("%s: expected ErrInvalidFrame, got %v", name, err)
+			}
+		}
+
+		f := frame
+		f.SensorId = strings.Repeat("a", 256)
+		if _, err := f.MarshalBinary(); err == nil {
+			t.Fatal("expected an error for a long sensor ID")
+		}
+	})
+}
+
+func FuzzFrameBinary(f *testing.F) {
+	frame := SpectrumFrame{
+		SensorId:   "sensor",
+		CampaignId: "campaign",
+		Time:       time.Date(2022, 6, 1, 12, 0, 0, 0, time.UTC),
+		FreqStart:  10e8,
+		FreqStep:   1e5,
+		Bins:       []float64{-90.5, math.NaN(), 12.75},
+	}
+	for _, enc := range []FrameEncoding{EncodingFloat32, EncodingInt16} {
+		raw, _ := AppendFrame(nil, frame, enc)
+		f.Add(raw)
+	}
+
+	f.Fuzz(func(t *testing.T, data []byte) {
+		got := SpectrumFrame{}
+		if err := got.UnmarshalBinary(data); err != nil {
+			return
+		}
+
+		enc := FrameEncoding(data[5])
+		raw, err := AppendFrame(nil, got, enc)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if enc == EncodingInt16 && !bytes.Equal(raw, data) {
+			t.Fatalf("expected %x, got %x", data, raw)
+		}
+		again := SpectrumFrame{}
+		if err := again.UnmarshalBinary(raw); err != nil {
+			t.Fatal(err)
+		}
+		if !equalFrames(again, got, 0) {
+			t.Fatalf("expected %+v, got %+v", got, again)
+		}
+	})
+}
+
+// Compares frames, with bins equal within tolerance (NaN equals NaN).
+func equalFrames(a SpectrumFrame, b SpectrumFrame, tolerance float64) bool {
+	if a.SensorId != b.SensorId || a.CampaignId != b.CampaignId || !a.Time.Equal(b.Time) ||
+		a.FreqStart != b.FreqStart || a.FreqStep != b.FreqStep || len(a.Bins) != len(b.Bins) {
+		return false
+	}
+	for i := range a.Bins {
+		if math.IsNaN(a.Bins[i]) != math.IsNaN(b.Bins[i]) || math.Abs(a.Bins[i]-b.Bins[i]) > tolerance {
+			return false
+		}
+	}
+	return true
+}
+
+func TestValidateFor(t *testing.T) {
+	rtlsdr := SensorCapabilities{
+		FreqMin:       24e6,
+		FreqMax:       1766e6,
+		MaxSampleRate: 3.2e6,
+		GainMin:       0,
+		GainMax:       49.6,
+		AGC:           true,
+		Modes:         []Mode{ModeAggregated, ModeRaw},
+		SampleFormats: []SampleFormat{SampleFormatCU8},
+	}
+	begin := time.Date(2022, 6, 1, 12, 0, 0, 0, time.UTC)
+
+	t.Run("capabilities", func(t *testing.T) {
+		if err := rtlsdr.Validate(); err != nil {
+			t.Fatal(err)
+		}
+		c := rtlsdr
+		c.Modes = []Mode{"sweep"}
+		if err := c.Validate(); err == nil {
+			t.Fatal("expected an error for an unknown mode")
+		}
+		c = rtlsdr
+		c.FreqMin = c.FreqMax + 1
+		if err := c.Validate(); err == nil {
+			t.Fatal("expected an error for FreqMin > FreqMax")
+		}
+	})
+
+	t.Run("aggregated", func(t *testing.T) {
+		amr := AggregatedMeasurementRequest{
+			Sensors: []string{"a"},
+			Begin:   begin,
+			End:     begin.Add(time.Hour),
+			FreqMin: 88e6,
+			FreqMax: 108e6,
+			FreqRes: 1e5,
+			TimeRes: 60,
+		}
+		if err := amr.ValidateFor(rtlsdr); err != nil {
+			t.Fatal(err)
+		}
+
+		amr.FreqMin, amr.FreqMax = 5900e6, 6000e6
+		if code := errorCode(t, amr.ValidateFor(rtlsdr), "freqMax"); code != ErrFreqOutOfRange.Code() {
+			t.Fatalf("expected %s, got %s", ErrFreqOutOfRange.Code(), code)
+		}
+
+		c := rtlsdr
+		c.Modes = []Mode{ModeRaw}
+		if code := errorCode(t, amr.ValidateFor(c), "sensors"); code != ErrModeUnsupported.Code() {
+			t.Fatalf("expected %s, got %s", ErrModeUnsupported.Code(), code)
+		}
+	})
+
+	t.Run("raw", func(t *testing.T) {
+		valid := func() RawMeasurementRequest {
+			return RawMeasurementRequest{
+				Sensors:      []string{"a"},
+				Begin:        begin,
+				End:          begin.Add(time.Minute),
+				FreqCenter:   433.92e6,
+				SampleRate:   2.4e6,
+				Gain:         40,
+				SampleFormat: SampleFormatCU8,
+			}
+		}
+		if err := valid().ValidateFor(rtlsdr); err != nil {
+			t.Fatal(err)
+		}
+
+		cases := []struct {
+			name   string
+			modify func(rmr *RawMeasurementRequest)
+			field  string
+			code   string
+		}{
+			{"frequency", func(rmr *RawMeasurementRequest) { rmr.FreqCenter = 6e9 }, "freqCenter", ErrFreqOutOfRange.Code()},
+			{"band below FreqMin", func(rmr *RawMeasurementRequest) { rmr.FreqCenter = 25e6 }, "freqCenter", ErrFreqOutOfRange.Code()},
+			{"band above FreqMax", func(rmr *RawMeasurementRequest) { rmr.FreqCenter = 1765e6 }, "freqCenter", ErrFreqOutOfRange.Code()},
+			{"bandwidth below FreqMin", func(rmr *RawMeasurementRequest) { rmr.FreqCenter, rmr.Bandwidth = 24.4e6, 1e6 }, "freqCenter", ErrFreqOutOfRange.Code()},
+			{"sample rate", func(rmr *RawMeasurementRequest) { rmr.SampleRate = 10e6 }, "sampleRate", ErrSampleRateUnsupported.Code()},
+			{"gain", func(rmr *RawMeasurementRequest) { rmr.Gain = 60 }, "gain", ErrGainOutOfRange.Code()},
+			{"sample format", func(rmr *RawMeasurementRequest) { rmr.SampleFormat = "" }, "sampleFormat", ErrSampleFormatUnsupported.Code()},
+		}
+		for _, c := range cases {
+			t.Run(c.name, func(t *testing.T) {
+				rmr := valid()
+				c.modify(&rmr)
+				if code := errorCode(t, rmr.ValidateFor(rtlsdr), c.field); code != c.code {
+					t.Fatalf("expected %s, got %s", c.code, code)
+				}
+			})
+		}
+
+		rmr := valid()
+		rmr.FreqCenter, rmr.Bandwidth = 24.6e6, 1e6
+		if err := rmr.ValidateFor(rtlsdr); err != nil {
+			t.Fatal(err)
+		}
+		c := rtlsdr
+		c.Modes = []Mode{ModeAggregated}
+		if code := errorCode(t, rmr.ValidateFor(c), "sensors"); code != ErrModeUnsupported.Code() {
+			t.Fatalf("expected %s, got %s", ErrModeUnsupported.Code(), code)
+		}
+
+		rmr = valid()
+		rmr.Gain, rmr.AGC = 0, true
+		if err := rmr.ValidateFor(rtlsdr); err != nil {
+			t.Fatal(err)
+		}
+		c = rtlsdr
+		c.AGC = false
+		if code := errorCode(t, rmr.ValidateFor(c), "agc"); code != ErrAGCUnsupported.Code() {
+			t.Fatalf("expected %s, got %s", ErrAGCUnsupported.Code(), code)
+		}
+	})
+}
+
+func TestAPIError(t *testing.T) {
+	begin := time.Date(2022, 6, 1, 12, 0, 0, 0, time.UTC)
+	amr := AggregatedMeasurementRequest{
+		Sensors:     []string{"a", ""},
+		Begin:       begin,
+		End:         begin.Add(30 * time.Second),
+		FreqMin:     10e8,
+		FreqMax:     11e8,
+		FreqRes:     3e5,
+		TimeRes:     60,
+		Aggregation: "average",
+	}
+
+	t.Run("validation", func(t *testing.T) {
+		apiErr := NewAPIErrorFrom(amr.Validate())
+		if apiErr.Status != 400 || apiErr.Code != CodeValidationFailed {
+			t.Fatalf("expected 400 %s, got %d %s", CodeValidationFailed, apiErr.Status, apiErr.Code)
+		}
+
+		fields := []string{}
+		codes := []string{}
+		for _, d := range apiErr.Details {
+			fields = append(fields, d.Field)
+			codes = append(codes, d.Code)
+		}
+		expFields := []string{"/aggregation", "/freqRes", "/sensors/1", "/timeRes"}
+		expCodes := []string{ErrAggregationInvalid.Code(), ErrFreqResNotDivisor.Code(), "validation_required", ErrTimeResTooLong.Code()}
+		if !reflect.DeepEqual(fields, expFields) {
+			t.Fatalf("expected %v, got %v", expFields, fields)
+		}
+		if !reflect.DeepEqual(codes, expCodes) {
+			t.Fatalf("expected %v, got %v", expCodes, codes)
+		}
+
+		raw, err := json.Marshal(apiErr.Details[3])
+		if err != nil {
+			t.Fatal(err)
+		}
+		exp := `{"field":"/timeRes","code":"validation_time_res_too_long","message":"must not exceed the 30 seconds between Begin and End","params":{"max":30}}`
+		if string(raw) != exp {
+			t.Fatalf("expected %s, got %s", exp, raw)
+		}
+	})
+
+	t.Run("translation", func(t *testing.T) {
+		apiErr := NewAPIErrorFrom(amr.Validate())
+		translated := apiErr.Translate(map[string]string{
+			CodeValidationFailed:     "validazione fallita",
+			ErrTimeResTooLong.Code(): "non deve superare {{.max}} secondi",
+		})
+		if translated.Message != "validazione fallita" {
+			t.Fatalf("expected translated message, got %q", translated.Message)
+		}
+		if msg := translated.Details[3].Message; msg != "non deve superare 30 secondi" {
+			t.Fatalf("expected translated detail, got %q", msg)
+		}
+		if msg := translated.Details[1].Message; msg != apiErr.Details[1].Message {
+			t.Fatalf("expected untouched detail, got %q", msg)
+		}
+		if apiErr.Details[3].Message == translated.Details[3].Message {
+			t.Fatal("expected the original error to be unchanged")
+		}
+	})
+
+	t.Run("other errors", func(t *testing.T) {
+		if NewAPIErrorFrom(nil) != nil {
+			t.Fatal("expected nil for a nil error")
+		}
+
+		notFound := NewAPIError(404, "not_found", "campaign not found")
+		if got := NewAPIErrorFrom(fmt.Errorf("wrapped: %w", notFound)); got != notFound {
+			t.Fatalf("expected %v, got %v", notFound, got)
+		}
+
+		got := NewAPIErrorFrom(ErrModeUnsupported.SetParams(map[string]interface{}{"mode": ModeRaw}))
+		if got.Status != 400 || got.Code != ErrModeUnsupported.Code() || got.Message != "sensor does not support raw measurements" {
+			t.Fatalf("unexpected error %+v", got)
+		}
+
+		for _, err := range []error{errors.New("disk on fire"), v.NewInternalError(errors.New("disk on fire"))} {
+			got := NewAPIErrorFrom(err)
+			if got.Status != 500 || got.Code != CodeInternal || strings.Contains(got.Message, "fire") {
+				t.Fatalf("unexpected error %+v", got)
+			}
+		}
+	})
+}
+
+func TestCampaign(t *testing.T) {
+	begin := time.Date(2022, 6, 1, 12, 0, 0, 0, time.UTC)
+	newCampaign := func() *Campaign {
+		c := NewCampaign("campaign").
+			WithMode(ModeAggregated).
+			WithWindow(begin, begin.Add(time.Hour)).
+			WithSensors("b", "a")
+		c.History[0].Time = begin.Add(-time.Hour)
+		return c
+	}
+
+	t.Run("transitions", func(t *testing.T) {
+		c := newCampaign()
+		if err := c.TransitionAt(CampaignRunning, begin, ""); !errors.Is(err, ErrInvalidTransition) {
+			t.Fatalf("expected ErrInvalidTransition, got %v", err)
+		}
+		if err := c.TransitionAt(CampaignScheduled, begin.Add(-time.Minute), ""); err != nil {
+			t.Fatal(err)
+		}
+		if err := c.TransitionAt(CampaignRunning, begin.Add(-2*time.Minute), ""); !errors.Is(err, ErrInvalidTransition) {
+			t.Fatalf("expected ErrInvalidTransition for a time in the past, got %v", err)
+		}
+		if err := c.TransitionAt(CampaignRunning, begin, ""); err != nil {
+			t.Fatal(err)
+		}
+		if err := c.TransitionAt(CampaignFailed, begin.Add(time.Minute), "sensor a offline"); err != nil {
+			t.Fatal(err)
+		}
+		if !c.State.Terminal() {
+			t.Fatalf("expected %s to be terminal", c.State)
+		}
+		for _, to := range []CampaignState{CampaignPending, CampaignRunning, CampaignCancelled} {
+			if err := c.Transition(to, ""); !errors.Is(err, ErrInvalidTransition) {
+				t.Fatalf("expected ErrInvalidTransition to %s, got %v", to, err)
+			}
+		}
+
+		if at, ok := c.EnteredAt(CampaignRunning); !ok || !at.Equal(begin) {
+			t.Fatalf("expected %v, got %v", begin, at)
+		}
+		if _, ok := c.EnteredAt(CampaignCompleted); ok {
+			t.Fatal("expected the campaign to never be completed")
+		}
+		if last := c.History[len(c.History)-1]; last.Reason != "sensor a offline" {
+			t.Fatalf("expected reason, got %+v", last)
+		}
+	})
+
+	t.Run("progress", func(t *testing.T) {
+		c := newCampaign()
+		if err := c.UpdateProgress("a", 0.5, nil); err == nil {
+			t.Fatal("expected an error for a campaign which is not running")
+		}
+
+		_ = c.TransitionAt(CampaignScheduled, begin, "")
+		_ = c.TransitionAt(CampaignRunning, begin, "")
+		if err := c.UpdateProgress("a", 0.5, nil); err != nil {
+			t.Fatal(err)
+		}
+		if err := c.UpdateProgress("b", 0.25, errors.New("overrun")); err != nil {
+			t.Fatal(err)
+		}
+		for _, err := range []error{c.UpdateProgress("c", 0.5, nil), c.UpdateProgress("a", 1.5, nil), c.UpdateProgress("a", math.NaN(), nil)} {
+			if err == nil {
+				t.Fatal("expected an error")
+			}
+		}
+
+		if got := c.Completion(); got != 0.375 {
+			t.Fatalf("expected 0.375, got %v", got)
+		}
+		if got := c.Sensors["b"].Error; got != "overrun" {
+			t.Fatalf("expected overrun, got %q", got)
+		}
+		if got := c.SensorIds(); !reflect.DeepEqual(got, []string{"a", "b"}) {
+			t.Fatalf("expected [a b], got %v", got)
+		}
+	})
+
+	t.Run("json", func(t *testing.T) {
+		c := newCampaign()
+		_ = c.TransitionAt(CampaignCancelled, begin, "by user")
+		raw, err := json.Marshal(c)
+		if err != nil {
+			t.Fatal(err)
+		}
+		exp := `{"id":"campaign","mode":"aggregated","begin":"2022-06-01T12:00:00Z","end":"2022-06-01T13:00:00Z","state":"cancelled",` +
+			`"history":[{"state":"pending","time":"2022-06-01T11:00:00Z"},{"state":"cancelled","time":"2022-06-01T12:00:00Z","reason":"by user"}],` +
+			`"sensors":{"a":{"progress":0,"updatedAt":"0001-01-01T00:00:00Z"},"b":{"progress":0,"updatedAt":"0001-01-01T00:00:00Z"}}}`
+		if string(raw) != exp {
+			t.Fatalf("expected %s, got %s", exp, raw)
+		}
+
+		got := &Campaign{}
+		if err := json.Unmarshal(raw, got); err != nil {
+			t.Fatal(err)
+		}
+		if err := got.Validate(); err != nil {
+			t.Fatal(err)
+		}
+		if !reflect.DeepEqual(got, c) {
+			t.Fatalf("expected %+v, got %+v", c, got)
+		}
+
+		got.State = CampaignRunning
+		if code := errorCode(t, got.Validate(), "history"); code != ErrHistoryEnd.Code() {
+			t.Fatalf("expected %s, got %s", ErrHistoryEnd.Code(), code)
+		}
+		got.State = CampaignCompleted
+		got.History = append(got.History, Transition{State: CampaignCompleted, Time: begin.Add(time.Hour)})
+		err = got.Validate()
+		if code := errorCode(t, err, "history"); code != ErrTransitionNotAllowed.Code() {
+			t.Fatalf("expected %s, got %s", ErrTransitionNotAllowed.Code(), code)
+		}
+		if msg := err.(v.Errors)["history"].Error(); msg != "cannot move from cancelled to completed" {
+			t.Fatalf("unexpected message %q", msg)
+		}
+	})
+
+	t.Run("no sensors", func(t *testing.T) {
+		literal := &Campaign{Id: "campaign"}
+		decoded := &Campaign{}
+		if err := json.Unmarshal([]byte(`{"id":"campaign","state":"running"}`), decoded); err != nil {
+			t.Fatal(err)
+		}
+
+		for _, c := range []*Campaign{literal, decoded} {
+			if got := c.Completion(); got != 0 {
+				t.Fatalf("expected 0, got %v", got)
+			}
+			if got := c.SensorIds(); len(got) != 0 {
+				t.Fatalf("expected no sensors, got %v", got)
+			}
+			if err := c.UpdateProgress("a", 0.5, nil); err == nil {
+				t.Fatal("expected an error for a sensor which is not part of the campaign")
+			}
+
+			c.State = CampaignRunning
+			c.WithSensors("a")
+			if err := c.UpdateProgress("a", 0.5, nil); err != nil {
+				t.Fatal(err)
+			}
+			if got := c.SensorIds(); !reflect.DeepEqual(got, []string{"a"}) {
+				t.Fatalf("expected [a], got %v", got)
+			}
+		}
+	})
+}
+
+func TestSchedule(t *testing.T) {
+	rome, err := time.LoadLocation("Europe/Rome")
+	if err != nil {
+		t.Fatal(err)
+	}
+	begins := func(t *testing.T, s *Schedule, from time.Time, n int) []string {
+		t.Helper()
+		it, err := s.Windows(from)
+		if err != nil {
+			t.Fatal(err)
+		}
+		ret := []string{}
+		for _, w := range it.Take(n) {
+			if w.End.Sub(w.Begin) != time.Duration(s.Duration)*time.Second {
+				t.Fatalf("unexpected window %+v", w)
+			}
+			ret = append(ret, w.Begin.Format("2006-01-02 15:04 MST"))
+		}
+		return ret
+	}
+
+	t.Run("cron", func(t *testing.T) {
+		// Nightly across the switch to daylight saving time
+		s := NewCronSchedule("0 1 * * *", 2*time.Hour).WithTimeZone("Europe/Rome")
+		got := begins(t, s, time.Date(2022, 3, 26, 1, 30, 0, 0, rome), 3)
+		exp := []string{"2022-03-26 01:00 CET", "2022-03-27 01:00 CET", "2022-03-28 01:00 CEST"}
+		if !reflect.DeepEqual(got, exp) {
+			t.Fatalf("expected %v, got %v", exp, got)
+		}
+
+		s = NewCronSchedule("*/15 9-17 * * MON-FRI", 10*time.Minute)
+		got = begins(t, s, time.Date(2022, 6, 3, 17, 56, 0, 0, time.UTC), 2)
+		exp = []string{"2022-06-06 09:00 UTC", "2022-06-06 09:15 UTC"}
+		if !reflect.DeepEqual(got, exp) {
+			t.Fatalf("expected %v, got %v", exp, got)
+		}
+
+		// Either day field matches if both are restricted
+		s = NewCronSchedule("0 0 13 * FRI", time.Hour)
+		got = begins(t, s, time.Date(2022, 5, 1, 0, 0, 0, 0, time.UTC), 3)
+		exp = []string{"2022-05-06 00:00 UTC", "2022-05-13 00:00 UTC", "2022-05-20 00:00 UTC"}
+		if !reflect.DeepEqual(got, exp) {
+			t.Fatalf("expected %v, got %v", exp, got)
+		}
+
+		s = NewCronSchedule("@daily", time.Hour).WithUntil(time.Date(2022, 5, 3, 0, 0, 0, 0, time.UTC))
+		if got := begins(t, s, time.Date(2022, 5, 1, 0, 0, 0, 0, time.UTC), 5); len(got) != 2 {
+			t.Fatalf("expected 2 windows before until, got %v", got)
+		}
+
+		for _, expr := range []string{"60 * * * *", "* * *", "1-0 * * * *", "*/0 * * * *", "* * * FOO *"} {
+			if _, err := NewCronSchedule(expr, time.Hour).Windows(time.Now()); err == nil {
+				t.Fatalf("expected an error for %q", expr)
+			}
+		}
+	})
+
+	t.Run("rrule", func(t *testing.T) {
+		start := time.Date(2022, 6, 1, 0, 0, 0, 0, time.UTC)
+		s := NewRRuleSchedule("FREQ=WEEKLY;BYDAY=MO,WE;BYHOUR=22;BYMINUTE=30;COUNT=3", start, time.Hour)
+		got := begins(t, s, start, 5)
+		exp := []string{"2022-06-01 22:30 UTC", "2022-06-06 22:30 UTC", "2022-06-08 22:30 UTC"}
+		if !reflect.DeepEqual(got, exp) {
+			t.Fatalf("expected %v, got %v", exp, got)
+		}
+		// Windows before from still count towards COUNT
+		got = begins(t, s, time.Date(2022, 6, 7, 0, 0, 0, 0, time.UTC), 5)
+		if !reflect.DeepEqual(got, exp[2:]) {
+			t.Fatalf("expected %v, got %v", exp[2:], got)
+		}
+
+		s = NewRRuleSchedule("RRULE:FREQ=MONTHLY;BYMONTHDAY=-1;UNTIL=20220901T000000Z", start.Add(2*time.Hour), time.Hour)
+		got = begins(t, s, start, 5)
+		exp = []string{"2022-06-30 02:00 UTC", "2022-07-31 02:00 UTC", "2022-08-31 02:00 UTC"}
+		if !reflect.DeepEqual(got, exp) {
+			t.Fatalf("expected %v, got %v", exp, got)
+		}
+
+		s = NewRRuleSchedule("FREQ=DAILY;INTERVAL=2", time.Date(2022, 3, 25, 1, 0, 0, 0, rome), 2*time.Hour).WithTimeZone("Europe/Rome")
+		got = begins(t, s, start, 3)
+		exp = []string{"2022-06-01 01:00 CEST", "2022-06-03 01:00 CEST", "2022-06-05 01:00 CEST"}
+		if !reflect.DeepEqual(got, exp) {
+			t.Fatalf("expected %v, got %v", exp, got)
+		}
+
+		s = NewRRuleSchedule("FREQ=HOURLY;INTERVAL=6;BYMINUTE=15", start, time.Hour)
+		got = begins(t, s, start, 2)
+		exp = []string{"2022-06-01 00:15 UTC", "2022-06-01 06:15 UTC"}
+		if !reflect.DeepEqual(got, exp) {
+			t.Fatalf("expected %v, got %v", exp, got)
+		}
+
+		// Days which do not match are skipped without expanding every minute
+		s = NewRRuleSchedule("FREQ=MINUTELY;INTERVAL=30;BYMONTH=2;BYMONTHDAY=29;BYHOUR=12", start, time.Minute)
+		got = begins(t, s, start, 3)
+		exp = []string{"2024-02-29 12:00 UTC", "2024-02-29 12:30 UTC", "2028-02-29 12:00 UTC"}
+		if !reflect.DeepEqual(got, exp) {
+			t.Fatalf("expected %v, got %v", exp, got)
+		}
+
+		for _, rule := range []string{"FREQ=MINUTELY;BYMONTH=2;BYMONTHDAY=30", "FREQ=MINUTELY;INTERVAL=2;BYMINUTE=1"} {
+			begin := time.Now()
+			s = NewRRuleSchedule(rule, start, time.Minute)
+			if got := begins(t, s, start, 1); len(got) != 0 {
+				t.Fatalf("expected no windows for %q, got %v", rule, got)
+			}
+			if code := errorCode(t, s.Validate(), "rrule"); code != ErrScheduleNoWindows.Code() {
+				t.Fatalf("expected %s, got %s", ErrScheduleNoWindows.Code(), code)
+			}
+			if elapsed := time.Since(begin); elapsed > 500*time.Millisecond {
+				t.Fatalf("expected %q to give up quickly, took %v", rule, elapsed)
+			}
+		}
+
+		// Without COUNT, occurrences before from are not replayed
+		begin := time.Now()
+		s = NewRRuleSchedule("FREQ=MINUTELY", time.Date(2016, 1, 1, 0, 0, 30, 0, time.UTC), 30*time.Second)
+		got = begins(t, s, time.Date(2026, 10, 19, 12, 0, 45, 0, time.UTC), 2)
+		exp = []string{"2026-10-19 12:00 UTC", "2026-10-19 12:01 UTC"}
+		if !reflect.DeepEqual(got, exp) {
+			t.Fatalf("expected %v, got %v", exp, got)
+		}
+		if elapsed := time.Since(begin); elapsed > 100*time.Millisecond {
+			t.Fatalf("expected the first windows quickly, took %v", elapsed)
+		}
+		for _, rule := range []string{"FREQ=YEARLY;INTERVAL=3", "FREQ=MONTHLY;INTERVAL=5;BYMONTHDAY=-1", "FREQ=WEEKLY;INTERVAL=2;BYDAY=MO,FR", "FREQ=DAILY;INTERVAL=9", "FREQ=HOURLY;INTERVAL=7"} {
+			s = NewRRuleSchedule(rule, time.Date(2019, 3, 30, 1, 30, 0, 0, rome), time.Hour).WithTimeZone("Europe/Rome")
+			from := time.Date(2025, 10, 26, 0, 0, 0, 0, rome)
+			counted := NewRRuleSchedule(rule+";COUNT=100000", s.Start, time.Hour).WithTimeZone("Europe/Rome")
+			if got, exp := begins(t, s, from, 5), begins(t, counted, from, 5); len(got) != 5 || !reflect.DeepEqual(got, exp) {
+				t.Fatalf("%q: expected %v, got %v", rule, exp, got)
+			}
+		}
+
+		for _, rule := range []string{"FREQ=SECONDLY", "BYDAY=MO", "FREQ=DAILY;BYSETPOS=1", "FREQ=DAILY;COUNT=1;UNTIL=20220101", "FREQ=MONTHLY;BYDAY=1MO"} {
+			if _, err := NewRRuleSchedule(rule, start, time.Hour).Windows(start); err == nil {
+				t.Fatalf("expected an error for %q", rule)
+			}
+		}
+	})
+
+	t.Run("validation", func(t *testing.T) {
+		start := time.Date(2022, 6, 1, 0, 0, 0, 0, time.UTC)
+		valid := []*Schedule{
+			NewCronSchedule("0 1 * * *", 2*time.Hour).WithTimeZone("Europe/Rome"),
+			NewRRuleSchedule("FREQ=DAILY;BYHOUR=1", start, 2*time.Hour),
+		}
+		for _, s := range valid {
+			if err := s.Validate(); err != nil {
+				t.Fatal(err)
+			}
+		}
+
+		s := NewCronSchedule("*/5 * * * *", 10*time.Minute).WithStart(start)
+		if code := errorCode(t, s.Validate(), "duration"); code != ErrScheduleOverlap.Code() {
+			t.Fatalf("expected %s, got %s", ErrScheduleOverlap.Code(), code)
+		}
+
+		invalid := map[string]*Schedule{
+			"both":          {Cron: "0 1 * * *", RRule: "FREQ=DAILY", Start: start, Duration: 60},
+			"neither":       {Duration: 60},
+			"no start":      {RRule: "FREQ=DAILY", Duration: 60},
+			"no duration":   {Cron: "0 1 * * *"},
+			"bad time zone": {Cron: "0 1 * * *", Duration: 60, TimeZone: "Mars/Olympus_Mons"},
+			"bad cron":      {Cron: "0 25 * * *", Duration: 60},
+			"never fires":   {Cron: "0 0 30 2 *", Duration: 60},
+		}
+		for name, s := range invalid {
+			if err := s.Validate(); err == nil {
+				t.Fatalf("expected an error for %s", name)
+			}
+		}
+		if code := errorCode(t, invalid["bad time zone"].Validate(), "timeZone"); code != ErrTimeZoneInvalid.Code() {
+			t.Fatalf("expected %s, got %s", ErrTimeZoneInvalid.Code(), code)
+		}
+		if code := errorCode(t, invalid["bad cron"].Validate(), "cron"); code != ErrCronInvalid.Code() {
+			t.Fatalf("expected %s, got %s", ErrCronInvalid.Code(), code)
+		}
+		if code := errorCode(t, invalid["never fires"].Validate(), "cron"); code != ErrScheduleNoWindows.Code() {
+			t.Fatalf("expected %s, got %s", ErrScheduleNoWindows.Code(), code)
+		}
+	})
+
+	t.Run("json", func(t *testing.T) {
+		s := NewCronSchedule("0 1 * * *", 2*time.Hour).WithTimeZone("Europe/Rome")
+		raw, err := json.Marshal(s)
+		if err != nil {
+			t.Fatal(err)
+		}
+		exp := `{"cron":"0 1 * * *","start":"0001-01-01T00:00:00Z","until":"0001-01-01T00:00:00Z","duration":7200,"timeZone":"Europe/Rome"}`
+		if string(raw) != exp {
+			t.Fatalf("expected %s, got %s", exp, raw)
+		}
+
+		got := &Schedule{}
+		if err := json.Unmarshal(raw, got); err != nil {
+			t.Fatal(err)
+		}
+		if !reflect.DeepEqual(got, s) {
+			t.Fatalf("expected %+v, got %+v", s, got)
+		}
+	})
+}
+
+func TestUnits(t *testing.T) {
+	t.Run("frequency", func(t *testing.T) {
+		cases := map[string]Frequency{
+			"433.92MHz":   433920000,
+			"2.4 GHz":     2400000000,
+			"100khz":      100000,
+			"1e9":         Gigahertz,
+			"1000":        Kilohertz,
+			"12.5 kHz":    12500,
+			"-1MHz":       -Megahertz,
+			" 5.8GHz ":    5800000000,
+			"0.000001GHz": Kilohertz,
+		}
+		for s, exp := range cases {
+			got, err := ParseFrequency(s)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got != exp {
+				t.Fatalf("%q: expected %d, got %d", s, exp, got)
+			}
+		}
+		for _, s := range []string{"", "MHz", "1.5Hz", "fast", "1THz", "99999999999GHz", "0x10MHz", "1/2kHz", "1e99999Hz", "1..5MHz"} {
+			if _, err := ParseFrequency(s); err == nil {
+				t.Fatalf("expected an error for %q", s)
+			}
+		}
+		if _, err := ParseFrequency("9.3e18"); err == nil || !strings.Contains(err.Error(), "out of range") {
+			t.Fatalf("expected an out of range error, got %v", err)
+		}
+
+		strs := map[Frequency]string{433920000: "433.92MHz", 2400000000: "2.4GHz", 500: "500Hz", 0: "0Hz", -12500: "-12.5kHz"}
+		for f, exp := range strs {
+			if f.String() != exp {
+				t.Fatalf("expected %s, got %s", exp, f.String())
+			}
+		}
+
+		if n, exact := (100 * Megahertz).Steps(300 * Kilohertz); n != 333 || exact {
+			t.Fatalf("expected 333 inexact steps, got %d %v", n, exact)
+		}
+		if got := Gigahertz.Add(Megahertz.Mul(400)).Sub(Kilohertz); got != 1399999000 {
+			t.Fatalf("expected 1399999000, got %d", got)
+		}
+		if !Gigahertz.Between(Megahertz, Gigahertz) || Gigahertz.Between(0, Megahertz) {
+			t.Fatal("unexpected result of Between")
+		}
+	})
+
+	t.Run("power", func(t *testing.T) {
+		cases := map[string]Power{
+			"-90dBm":    -90,
+			"-90.5 dbm": -90.5,
+			"1mW":       0,
+			"1 W":       30,
+			"10uW":      -20,
+			"10µW":      -20,
+			"1nW":       -60,
+			"13":        13,
+		}
+		for s, exp := range cases {
+			got, err := ParsePower(s)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if math.Abs(float64(got-exp)) > 1e-9 {
+				t.Fatalf("%q: expected %v, got %v", s, exp, got)
+			}
+		}
+		for _, s := range []string{"", "dBm", "0mW", "-1W", "1MW", "loud"} {
+			if _, err := ParsePower(s); err == nil {
+				t.Fatalf("expected an error for %q", s)
+			}
+		}
+
+		if s := Power(-90.5).String(); s != "-90.5dBm" {
+			t.Fatalf("expected -90.5dBm, got %s", s)
+		}
+		if got := Power(0).Add(0); math.Abs(float64(got)-3.0103) > 1e-4 {
+			t.Fatalf("expected about 3.01dBm, got %v", got)
+		}
+		if got := Power(-90).Gain(20); got != -70 {
+			t.Fatalf("expected -70dBm, got %v", got)
+		}
+	})
+
+	t.Run("json", func(t *testing.T) {
+		amr := AggregatedMeasurementRequest{}
+		err := json.Unmarshal([]byte(`{"sensors":["a"],"freqMin":"88MHz","freqMax":108000000,"freqRes":"100 kHz"}`), &amr)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if amr.FreqMin != 88*Megahertz || amr.FreqMax != 108*Megahertz || amr.FreqRes != 100*Kilohertz {
+			t.Fatalf("unexpected frequencies %v %v %v", amr.FreqMin, amr.FreqMax, amr.FreqRes)
+		}
+		raw, err := json.Marshal(amr.FreqMin)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if string(raw) != "88000000" {
+			t.Fatalf("expected 88000000, got %s", raw)
+		}
+
+		rmr := RawMeasurementRequest{}
+		if err := json.Unmarshal([]byte(`{"FreqCenter":"433.92MHz"}`), &rmr); err != nil {
+			t.Fatal(err)
+		}
+		if rmr.FreqCenter != 433920000 {
+			t.Fatalf("expected 433920000, got %d", rmr.FreqCenter)
+		}
+
+		if err := json.Unmarshal([]byte(`{"freqMin":"fast"}`), &amr); err == nil {
+			t.Fatal("expected an error for an invalid frequency")
+		}
+
+		freqs := []Frequency{}
+		if err := json.Unmarshal([]byte(`[1.5e6, 433920000.0, 1E3, -0]`), &freqs); err != nil {
+			t.Fatal(err)
+		}
+		if !reflect.DeepEqual(freqs, []Frequency{1500000, 433920000, 1000, 0}) {
+			t.Fatalf("expected [1500000 433920000 1000 0], got %v", freqs)
+		}
+		for _, raw := range []string{`0.5`, `1e-1`, `9.3e18`, `true`} {
+			f := Frequency(0)
+			if err := json.Unmarshal([]byte(raw), &f); err == nil {
+				t.Fatalf("expected an error for %s", raw)
+			}
+		}
+
+		levels := []Power{}
+		if err := json.Unmarshal([]byte(`[-90, "1mW", "-3.5dBm"]`), &levels); err != nil {
+			t.Fatal(err)
+		}
+		if !reflect.DeepEqual(levels, []Power{-90, 0, -3.5}) {
+			t.Fatalf("expected [-90 0 -3.5], got %v", levels)
 		}
 	})
 }
@@ -0,0 +1,261 @@
+// Copyright (C) 2022 OpenRFSense
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Affero General Public License as
+// published by the Free Software Foundation, either version 3 of the
+// License, or (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU Affero General Public License for more details.
+//
+// You should have received a copy of the GNU Affero General Public License
+// along with this program.  If not, see <http://www.gnu.org/licenses/>.
+
+package types
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"math"
+	"math/big"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+// Type Frequency is a frequency in Hz. It is encoded in JSON as a number of Hz,
+// and decoded from either a number or a string accepted by ParseFrequency.
+type Frequency int64
+
+const (
+	Hertz     Frequency = 1
+	Kilohertz Frequency = 1e3
+	Megahertz Frequency = 1e6
+	Gigahertz Frequency = 1e9
+)
+
+// Decimal numbers accepted by ParseFrequency, with an optional (short) exponent.
+var decimalNumber = regexp.MustCompile(`^[+-]?(\d+\.?\d*|\.\d+)([eE][+-]?\d{1,3})?$`)
+
+// Frequency units, largest first.
+var frequencyUnits = []struct {
+	name string
+	unit Frequency
+}{
+	{"GHz", Gigahertz},
+	{"MHz", Megahertz},
+	{"kHz", Kilohertz},
+	{"Hz", Hertz},
+}
+
+// Parses a frequency such as "433.92MHz", "2.4 GHz" or "100000". The number is
+// decimal, optionally with an exponent. Units (Hz, kHz, MHz or GHz) are
+// case-insensitive, a bare number is in Hz. The result must be a whole number of
+// Hz.
+func ParseFrequency(s string) (Frequency, error) {
+	number, unit := strings.TrimSpace(s), Hertz
+	for _, u := range frequencyUnits {
+		if len(number) > len(u.name) && strings.EqualFold(number[len(number)-len(u.name):], u.name) {
+			number, unit = strings.TrimSpace(number[:len(number)-len(u.name)]), u.unit
+			break
+		}
+	}
+
+	return frequencyOf(number, unit, s)
+}
+
+// Returns the decimal number times unit, which must be a whole number of Hz. s
+// is the input, as reported in errors.
+func frequencyOf(number string, unit Frequency, s string) (Frequency, error) {
+	if !decimalNumber.MatchString(number) {
+		return 0, fmt.Errorf("invalid frequency %q", s)
+	}
+	r, ok := new(big.Rat).SetString(number)
+	if !ok {
+		return 0, fmt.Errorf("invalid frequency %q", s)
+	}
+	r.Mul(r, new(big.Rat).SetInt64(int64(unit)))
+	if !r.IsInt() {
+		return 0, fmt.Errorf("frequency %q is not a whole number of Hz", s)
+	}
+	if !r.Num().IsInt64() {
+		return 0, fmt.Errorf("frequency %q is out of range", s)
+	}
+	return Frequency(r.Num().Int64()), nil
+}
+
+// Returns the frequency in Hz.
+func (f Frequency) Hz() int64 {
+	return int64(f)
+}
+
+// Formats the frequency in the largest unit it is at least one of, such as
+// "433.92MHz".
+func (f Frequency) String() string {
+	abs := f
+	if abs < 0 {
+		abs = -abs
+	}
+	for _, u := range frequencyUnits {
+		if abs >= u.unit || u.unit == Hertz {
+			return strconv.FormatFloat(float64(f)/float64(u.unit), 'f', -1, 64) + u.name
+		}
+	}
+	return ""
+}
+
+// Returns f + o.
+func (f Frequency) Add(o Frequency) Frequency {
+	return f + o
+}
+
+// Returns f - o.
+func (f Frequency) Sub(o Frequency) Frequency {
+	return f - o
+}
+
+// Returns f multiplied by n.
+func (f Frequency) Mul(n int64) Frequency {
+	return f * Frequency(n)
+}
+
+// Returns how many steps of res fit in f, and whether they fit exactly. Returns
+// 0 and false if res is not positive.
+func (f Frequency) Steps(res Frequency) (int64, bool) {
+	if res <= 0 {
+		return 0, false
+	}
+	return int64(f / res), f%res == 0
+}
+
+// Returns true if f is between min and max, both included.
+func (f Frequency) Between(min Frequency, max Frequency) bool {
+	return f >= min && f <= max
+}
+
+// Decodes the frequency from a number of Hz, which may have a fraction or an
+// exponent as long as it is whole, or a string accepted by ParseFrequency.
+func (f *Frequency) UnmarshalJSON(data []byte) error {
+	if bytes.HasPrefix(data, []byte(`"`)) {
+		s := ""
+		if err := json.Unmarshal(data, &s); err != nil {
+			return err
+		}
+		parsed, err := ParseFrequency(s)
+		if err != nil {
+			return err
+		}
+		*f = parsed
+		return nil
+	}
+
+	if bytes.Equal(data, []byte("null")) {
+		return nil
+	}
+	hz, err := frequencyOf(string(data), Hertz, string(data))
+	if err != nil {
+		return err
+	}
+	*f = hz
+	return nil
+}
+
+// Type Power is a power level in dBm. It is encoded in JSON as a number of dBm,
+// and decoded from either a number or a string accepted by ParsePower.
+type Power float64
+
+// Power units relative to mW, dBm excluded.
+var powerUnits = []struct {
+	name string
+	mw   float64
+}{
+	{"mW", 1},
+	{"uW", 1e-3},
+	{"µW", 1e-3},
+	{"nW", 1e-6},
+	{"pW", 1e-9},
+	{"W", 1e3},
+}
+
+// Returns the power level of the given linear power in mW.
+func PowerFromMilliwatts(mw float64) Power {
+	return Power(10 * math.Log10(mw))
+}
+
+// Parses a power level such as "-90dBm", "-90.5 dBm", "1mW" or "10uW". dBm is
+// case-insensitive, W, mW, uW (or µW), nW and pW are not. A bare number is in
+// dBm. Linear powers must be positive.
+func ParsePower(s string) (Power, error) {
+	number := strings.TrimSpace(s)
+	if len(number) > 3 && strings.EqualFold(number[len(number)-3:], "dBm") {
+		number = strings.TrimSpace(number[:len(number)-3])
+	} else {
+		for _, u := range powerUnits {
+			if strings.HasSuffix(number, u.name) {
+				value, err := strconv.ParseFloat(strings.TrimSpace(strings.TrimSuffix(number, u.name)), 64)
+				if err != nil || !(value > 0) || math.IsInf(value, 0) {
+					return 0, fmt.Errorf("invalid power %q", s)
+				}
+				return PowerFromMilliwatts(value * u.mw), nil
+			}
+		}
+	}
+
+	value, err := strconv.ParseFloat(number, 64)
+	if err != nil || math.IsNaN(value) || math.IsInf(value, 0) {
+		return 0, fmt.Errorf("invalid power %q", s)
+	}
+	return Power(value), nil
+}
+
+// Returns the power level in dBm.
+func (p Power) DBm() float64 {
+	return float64(p)
+}
+
+// Returns the linear power in mW.
+func (p Power) Milliwatts() float64 {
+	return math.Pow(10, float64(p)/10)
+}
+
+// Formats the power level in dBm, such as "-90.5dBm".
+func (p Power) String() string {
+	return strconv.FormatFloat(float64(p), 'f', -1, 64) + "dBm"
+}
+
+// Returns the level of the sum of the linear powers of p and o.
+func (p Power) Add(o Power) Power {
+	return PowerFromMilliwatts(p.Milliwatts() + o.Milliwatts())
+}
+
+// Returns p amplified by the given gain in dB (attenuated if negative).
+func (p Power) Gain(db float64) Power {
+	return p + Power(db)
+}
+
+// Decodes the power level from a number of dBm or a string accepted by
+// ParsePower.
+func (p *Power) UnmarshalJSON(data []byte) error {
+	if bytes.HasPrefix(data, []byte(`"`)) {
+		s := ""
+		if err := json.Unmarshal(data, &s); err != nil {
+			return err
+		}
+		parsed, err := ParsePower(s)
+		if err != nil {
+			return err
+		}
+		*p = parsed
+		return nil
+	}
+
+	var dbm float64
+	if err := json.Unmarshal(data, &dbm); err != nil {
+		return fmt.Errorf("invalid power %s", data)
+	}
+	*p = Power(dbm)
+	return nil
+}
@@ -16,7 +16,6 @@
 package types
 
 import (
-	"fmt"
 	"time"
 
 	v "github.com/go-ozzo/ozzo-validation/v4"
@@ -25,47 +24,459 @@ import (
 var (
 	_ v.Validatable = &AggregatedMeasurementRequest{}
 	_ v.Validatable = &RawMeasurementRequest{}
+	_ v.Validatable = &SpectrumFrame{}
+	_ v.Validatable = &IQBlock{}
+	_ v.Validatable = &SensorCapabilities{}
+	_ v.Validatable = &Campaign{}
+	_ v.Validatable = &Schedule{}
 )
 
-// Returns error if "begin" is after "after".
+// Errors returned by the rules specific to this package. Every error in the
+// validation.Errors returned by Validate methods implements validation.Error, so
+// its Code can be used to tell failures apart (along with the codes of the
+// validation package, such as "validation_required").
+var (
+	ErrCampaignStateInvalid = v.NewError("validation_campaign_state_invalid", "must be one of pending, scheduled, running, completed, failed or cancelled")
+	ErrModeInvalid          = v.NewError("validation_mode_invalid", "must be one of aggregated or raw")
+	ErrSampleFormatInvalid  = v.NewError("validation_sample_format_invalid", "must be one of cf32, cs16, cs8 or cu8")
+	ErrAggregationInvalid   = v.NewError("validation_aggregation_invalid", "must be one of avg, min, max, median, rms or pN with N between 0 and 100")
+
+	ErrBeginNotBefore    = v.NewError("validation_begin_not_before_end", "must be before End")
+	ErrEndNotAfter       = v.NewError("validation_end_not_after_begin", "must be after Begin")
+	ErrTimeResTooLong    = v.NewError("validation_time_res_too_long", "must not exceed the {{.max}} seconds between Begin and End")
+	ErrFreqResNotDivisor = v.NewError("validation_freq_res_not_divisor", "must evenly divide FreqMax - FreqMin ({{.span}})")
+	ErrSpanTooWide       = v.NewError("validation_span_too_wide", "must span no more than {{.max}}")
+	ErrDurationTooLong   = v.NewError("validation_duration_too_long", "must be no more than {{.max}} after Begin")
+	ErrTooManySensors    = v.NewError("validation_too_many_sensors", "must contain no more than {{.max}} sensors")
+
+	ErrModeUnsupported         = v.NewError("validation_mode_unsupported", "sensor does not support {{.mode}} measurements")
+	ErrFreqOutOfRange          = v.NewError("validation_freq_out_of_range", "must be between {{.min}} and {{.max}} for the sensor")
+	ErrSampleRateUnsupported   = v.NewError("validation_sample_rate_unsupported", "must be no more than {{.max}} for the sensor")
+	ErrGainOutOfRange          = v.NewError("validation_gain_out_of_range", "must be between {{.min}} and {{.max}} dB for the sensor")
+	ErrAGCUnsupported          = v.NewError("validation_agc_unsupported", "sensor does not support AGC")
+	ErrSampleFormatUnsupported = v.NewError("validation_sample_format_unsupported", "sensor does not support this sample format")
+
+	ErrSamplesNotInterleaved = v.NewError("validation_samples_not_interleaved", "must contain interleaved I/Q pairs")
+	ErrSensorNotRequested    = v.NewError("validation_sensor_not_requested", "must be one of the requested sensors")
+	ErrTimeOutsideWindow     = v.NewError("validation_time_outside_window", "must be between Begin and End")
+
+	ErrHistoryStart         = v.NewError("validation_history_start", "must start with the pending state")
+	ErrTransitionNotAllowed = v.NewError("validation_transition_not_allowed", "cannot move from {{.from}} to {{.to}}")
+	ErrHistoryOrder         = v.NewError("validation_history_order", "must be in chronological order")
+	ErrHistoryEnd           = v.NewError("validation_history_end", "must end with the current state")
+	ErrProgressOutOfRange   = v.NewError("validation_progress_out_of_range", "progress must be between 0 and 1")
+
+	ErrCronInvalid       = v.NewError("validation_cron_invalid", "must be a valid cron expression: {{.reason}}")
+	ErrRRuleInvalid      = v.NewError("validation_rrule_invalid", "must be a valid recurrence rule: {{.reason}}")
+	ErrTimeZoneInvalid   = v.NewError("validation_time_zone_invalid", "must be a valid IANA time zone name")
+	ErrScheduleNoWindows = v.NewError("validation_schedule_no_windows", "never starts a window")
+	ErrScheduleOverlap   = v.NewError("validation_schedule_overlap", "windows starting at {{.first}} and {{.second}} overlap")
+)
+
+// Returns error if "begin" is not before "end".
 func isBefore(end time.Time) v.RuleFunc {
 	return func(value interface{}) error {
 		begin, _ := value.(time.Time)
-		if begin.After(end) {
-			return fmt.Errorf("Begin must be before End")
+		if !begin.Before(end) {
+			return ErrBeginNotBefore
 		}
 		return nil
 	}
 }
 
-// Returns error if "end" is before "begin".
+// Returns error if "end" is not after "begin".
 func isAfter(begin time.Time) v.RuleFunc {
 	return func(value interface{}) error {
 		end, _ := value.(time.Time)
-		if end.Before(begin) {
-			return fmt.Errorf("End must be after Begin")
+		if !end.After(begin) {
+			return ErrEndNotAfter
 		}
 		return nil
 	}
 }
 
-// Validates the measurement request.
+// Returns error if the time resolution in seconds exceeds the duration, if positive.
+func fitsDuration(d time.Duration) v.RuleFunc {
+	return func(value interface{}) error {
+		res, _ := value.(int64)
+		max := int64(d / time.Second)
+		if d > 0 && res > max {
+			return ErrTimeResTooLong.SetParams(map[string]interface{}{"max": max})
+		}
+		return nil
+	}
+}
+
+// Returns error if the frequency resolution, if positive, does not divide span.
+func divides(span Frequency) v.RuleFunc {
+	return func(value interface{}) error {
+		res, _ := value.(Frequency)
+		if _, exact := span.Steps(res); res > 0 && !exact {
+			return ErrFreqResNotDivisor.SetParams(map[string]interface{}{"span": span})
+		}
+		return nil
+	}
+}
+
+// Returns the rule checking the value against a policy limit, which is ignored if
+// zero. over reports whether the value exceeds the limit.
+func limit(err v.Error, max interface{}, over func(value interface{}) bool) v.Rule {
+	return v.By(func(value interface{}) error {
+		if over(value) {
+			return err.SetParams(map[string]interface{}{"max": max})
+		}
+		return nil
+	})
+}
+
+// Returns the rule checking that a band of the given width centered on the
+// frequency is between min and max, both included.
+func inBand(min Frequency, max Frequency, width Frequency) v.Rule {
+	min, max = min+width/2, max-width/2
+	return v.By(func(value interface{}) error {
+		f, _ := value.(Frequency)
+		if !f.Between(min, max) {
+			return ErrFreqOutOfRange.SetParams(map[string]interface{}{"min": min, "max": max})
+		}
+		return nil
+	})
+}
+
+// Returns the rule checking that a number is between min and max, both included.
+func inRange[T int64 | float64](err v.Error, min T, max T) v.Rule {
+	return v.By(func(value interface{}) error {
+		n, _ := value.(T)
+		if n < min || n > max {
+			return err.SetParams(map[string]interface{}{"min": min, "max": max})
+		}
+		return nil
+	})
+}
+
+// Returns the rule checking that the sensor supports the mode, whatever the value.
+func supports(c SensorCapabilities, m Mode) v.Rule {
+	return v.By(func(interface{}) error {
+		if !c.Supports(m) {
+			return ErrModeUnsupported.SetParams(map[string]interface{}{"mode": m})
+		}
+		return nil
+	})
+}
+
+// Returns the rule enforcing the maximum number of sensors of p.
+func (p *ValidationPolicy) sensorsRule() v.Rule {
+	return limit(ErrTooManySensors, p.MaxSensors, func(value interface{}) bool {
+		sensors, _ := value.([]string)
+		return p.MaxSensors > 0 && len(sensors) > p.MaxSensors
+	})
+}
+
+// Returns the rule enforcing the maximum duration of p on the end time.
+func (p *ValidationPolicy) durationRule(begin time.Time) v.Rule {
+	return limit(ErrDurationTooLong, p.MaxDuration, func(value interface{}) bool {
+		end, _ := value.(time.Time)
+		return p.MaxDuration > 0 && end.Sub(begin) > p.MaxDuration
+	})
+}
+
+// Returns the rule enforcing the maximum span of p on span.
+func (p *ValidationPolicy) spanRule(span Frequency) v.Rule {
+	return limit(ErrSpanTooWide, p.MaxSpan, func(interface{}) bool {
+		return p.MaxSpan > 0 && span > p.MaxSpan
+	})
+}
+
+// Validates the measurement request. Same as ValidateWith(nil).
 func (amr AggregatedMeasurementRequest) Validate() error {
+	return amr.ValidateWith(nil)
+}
+
+// Validates the measurement request, also enforcing the limits set in the
+// policy. A nil policy sets no limits.
+func (amr AggregatedMeasurementRequest) ValidateWith(p *ValidationPolicy) error {
+	if p == nil {
+		p = NewValidationPolicy()
+	}
+	span := amr.FreqMax.Sub(amr.FreqMin)
 	return v.ValidateStruct(&amr,
+		v.Field(&amr.Sensors, v.Required, v.Each(v.Required), p.sensorsRule()),
 		v.Field(&amr.Begin, v.Required, v.By(isBefore(amr.End))),
-		v.Field(&amr.End, v.Required, v.By(isAfter(amr.Begin))),
+		v.Field(&amr.End, v.Required, v.By(isAfter(amr.Begin)), p.durationRule(amr.Begin)),
 		v.Field(&amr.FreqMin, v.Required, v.Min(0), v.Max(amr.FreqMax)),
-		v.Field(&amr.FreqMax, v.Required, v.Min(amr.FreqMin)),
-		v.Field(&amr.FreqRes, v.Required, v.Max(amr.FreqMax-amr.FreqMin)),
-		v.Field(&amr.TimeRes, v.Required, v.Min(0)),
+		v.Field(&amr.FreqMax, v.Required, v.Min(amr.FreqMin), p.spanRule(span)),
+		v.Field(&amr.FreqRes, v.Required, v.Max(span), v.By(divides(span))),
+		v.Field(&amr.TimeRes, v.Required, v.Min(0), v.By(fitsDuration(amr.End.Sub(amr.Begin)))),
+		v.Field(&amr.Aggregation),
 	)
 }
 
-// Validates the measurement request.
+// Validates the measurement request. Same as ValidateWith(nil).
 func (rmr RawMeasurementRequest) Validate() error {
+	return rmr.ValidateWith(nil)
+}
+
+// Validates the measurement request, also enforcing the limits set in the
+// policy. A nil policy sets no limits.
+func (rmr RawMeasurementRequest) ValidateWith(p *ValidationPolicy) error {
+	if p == nil {
+		p = NewValidationPolicy()
+	}
 	return v.ValidateStruct(&rmr,
+		v.Field(&rmr.Sensors, v.Required, v.Each(v.Required), p.sensorsRule()),
 		v.Field(&rmr.Begin, v.Required, v.By(isBefore(rmr.End))),
-		v.Field(&rmr.End, v.Required, v.By(isAfter(rmr.Begin))),
+		v.Field(&rmr.End, v.Required, v.By(isAfter(rmr.Begin)), p.durationRule(rmr.Begin)),
 		v.Field(&rmr.FreqCenter, v.Required, v.Min(0)),
+		v.Field(&rmr.SampleRate, v.Required, v.Min(1), v.Max(int64(MaxSampleRate)), p.spanRule(Frequency(rmr.SampleRate))),
+		v.Field(&rmr.Bandwidth, v.Min(0), v.Max(rmr.SampleRate)),
+		v.Field(&rmr.Gain, v.Min(0.0), v.Max(float64(MaxGain)), v.When(rmr.AGC, v.Empty.Error("must be empty when AGC is set"))),
+		v.Field(&rmr.SampleFormat),
+	)
+}
+
+// Validates the request as Validate does, then checks that a sensor with the
+// given capabilities can fulfil it: it must support aggregated measurements
+// (reported on the sensors) and tune from FreqMin to FreqMax.
+func (amr AggregatedMeasurementRequest) ValidateFor(c SensorCapabilities) error {
+	if err := amr.Validate(); err != nil {
+		return err
+	}
+	return v.ValidateStruct(&amr,
+		v.Field(&amr.Sensors, supports(c, ModeAggregated)),
+		v.Field(&amr.FreqMin, inBand(c.FreqMin, c.FreqMax, 0)),
+		v.Field(&amr.FreqMax, inBand(c.FreqMin, c.FreqMax, 0)),
 	)
 }
+
+// Validates the request as Validate does, then checks that a sensor with the
+// given capabilities can fulfil it: it must support raw measurements (reported
+// on the sensors), receive the whole band around FreqCenter (Bandwidth wide if
+// set, SampleRate otherwise), sample at SampleRate, and support the requested
+// gain (or AGC) and sample format.
+func (rmr RawMeasurementRequest) ValidateFor(c SensorCapabilities) error {
+	if err := rmr.Validate(); err != nil {
+		return err
+	}
+	width := rmr.Bandwidth
+	if width == 0 {
+		width = Frequency(rmr.SampleRate)
+	}
+	return v.ValidateStruct(&rmr,
+		v.Field(&rmr.Sensors, supports(c, ModeRaw)),
+		v.Field(&rmr.FreqCenter, inBand(c.FreqMin, c.FreqMax, width)),
+		v.Field(&rmr.SampleRate, inRange(ErrSampleRateUnsupported, 0, c.MaxSampleRate)),
+		v.Field(&rmr.Gain, v.When(!rmr.AGC, inRange(ErrGainOutOfRange, c.GainMin, c.GainMax))),
+		v.Field(&rmr.AGC, v.When(!c.AGC, v.Empty.ErrorObject(ErrAGCUnsupported))),
+		v.Field(&rmr.SampleFormat, v.By(func(interface{}) error {
+			if !c.SupportsFormat(rmr.SampleFormat) {
+				return ErrSampleFormatUnsupported
+			}
+			return nil
+		})),
+	)
+}
+
+// Validates the sensor capabilities.
+func (c SensorCapabilities) Validate() error {
+	return v.ValidateStruct(&c,
+		v.Field(&c.FreqMin, v.Min(0), v.Max(c.FreqMax)),
+		v.Field(&c.FreqMax, v.Required),
+		v.Field(&c.MaxSampleRate, v.Min(0)),
+		v.Field(&c.GainMax, v.Min(c.GainMin)),
+		v.Field(&c.Modes, v.Required),
+		v.Field(&c.SampleFormats),
+	)
+}
+
+// Returns error if the number of values is odd.
+func isEvenLength(value interface{}) error {
+	samples, _ := value.([]float32)
+	if len(samples)%2 != 0 {
+		return ErrSamplesNotInterleaved
+	}
+	return nil
+}
+
+// Returns error if the sensor ID is not in the list.
+func isOneOf(sensors []string) v.RuleFunc {
+	return func(value interface{}) error {
+		sensor, _ := value.(string)
+		for _, s := range sensors {
+			if s == sensor {
+				return nil
+			}
+		}
+		return ErrSensorNotRequested
+	}
+}
+
+// Returns error if the time is not between begin (inclusive) and end (exclusive).
+func isBetween(begin time.Time, end time.Time) v.RuleFunc {
+	return func(value interface{}) error {
+		t, _ := value.(time.Time)
+		if t.Before(begin) || !t.Before(end) {
+			return ErrTimeOutsideWindow
+		}
+		return nil
+	}
+}
+
+// Validates the spectrum frame.
+func (f SpectrumFrame) Validate() error {
+	return v.ValidateStruct(&f,
+		v.Field(&f.SensorId, v.Required),
+		v.Field(&f.CampaignId, v.Required),
+		v.Field(&f.Time, v.Required),
+		v.Field(&f.FreqStart, v.Min(0)),
+		v.Field(&f.FreqStep, v.Required, v.Min(1)),
+		v.Field(&f.Bins, v.Required),
+	)
+}
+
+// Validates the IQ block.
+func (b IQBlock) Validate() error {
+	return v.ValidateStruct(&b,
+		v.Field(&b.SensorId, v.Required),
+		v.Field(&b.CampaignId, v.Required),
+		v.Field(&b.Time, v.Required),
+		v.Field(&b.FreqCenter, v.Required, v.Min(0)),
+		v.Field(&b.SampleRate, v.Required, v.Min(1)),
+		v.Field(&b.Samples, v.Required, v.By(isEvenLength)),
+	)
+}
+
+// Validates a frame returned for the measurement request: on top of
+// SpectrumFrame.Validate, the frame must come from one of the requested sensors
+// within Begin and End, and its bins must cover FreqMin to FreqMax in steps of
+// FreqRes. The campaign ID is checked only if set in the request.
+func (amr AggregatedMeasurementRequest) ValidateFrame(f SpectrumFrame) error {
+	if err := f.Validate(); err != nil {
+		return err
+	}
+
+	bins, _ := amr.FreqMax.Sub(amr.FreqMin).Steps(amr.FreqRes)
+	rules := []*v.FieldRules{
+		v.Field(&f.SensorId, v.By(isOneOf(amr.Sensors))),
+		v.Field(&f.Time, v.By(isBetween(amr.Begin, amr.End))),
+		v.Field(&f.FreqStart, v.In(amr.FreqMin).Error("must be equal to FreqMin")),
+		v.Field(&f.FreqStep, v.In(amr.FreqRes).Error("must be equal to FreqRes")),
+		v.Field(&f.Bins, v.Length(int(bins), int(bins)).Error("must have (FreqMax - FreqMin) / FreqRes bins")),
+	}
+	if amr.CampaignId != "" {
+		rules = append(rules, v.Field(&f.CampaignId, v.In(amr.CampaignId).Error("must be equal to the request CampaignId")))
+	}
+	return v.ValidateStruct(&f, rules...)
+}
+
+// Validates a block returned for the measurement request: on top of
+// IQBlock.Validate, the block must come from one of the requested sensors
+// within Begin and End, at the requested center frequency and sample rate. The
+// campaign ID is checked only if set in the request.
+func (rmr RawMeasurementRequest) ValidateBlock(b IQBlock) error {
+	if err := b.Validate(); err != nil {
+		return err
+	}
+
+	rules := []*v.FieldRules{
+		v.Field(&b.SensorId, v.By(isOneOf(rmr.Sensors))),
+		v.Field(&b.Time, v.By(isBetween(rmr.Begin, rmr.End))),
+		v.Field(&b.FreqCenter, v.In(rmr.FreqCenter).Error("must be equal to FreqCenter")),
+		v.Field(&b.SampleRate, v.In(rmr.SampleRate).Error("must be equal to SampleRate")),
+	}
+	if rmr.CampaignId != "" {
+		rules = append(rules, v.Field(&b.CampaignId, v.In(rmr.CampaignId).Error("must be equal to the request CampaignId")))
+	}
+	return v.ValidateStruct(&b, rules...)
+}
+
+// Returns error if the history does not start pending, contains a transition
+// which is not allowed or goes back in time, or does not end in state.
+func isHistoryOf(state CampaignState) v.RuleFunc {
+	return func(value interface{}) error {
+		history, _ := value.([]Transition)
+		if len(history) == 0 || history[0].State != CampaignPending {
+			return ErrHistoryStart
+		}
+		for i := 1; i < len(history); i++ {
+			prev, next := history[i-1], history[i]
+			if !prev.State.CanTransition(next.State) {
+				return ErrTransitionNotAllowed.SetParams(map[string]interface{}{"from": prev.State, "to": next.State})
+			}
+			if next.Time.Before(prev.Time) {
+				return ErrHistoryOrder
+			}
+		}
+		if history[len(history)-1].State != state {
+			return ErrHistoryEnd
+		}
+		return nil
+	}
+}
+
+// Validates the campaign, such as one decoded from JSON.
+func (c Campaign) Validate() error {
+	return v.ValidateStruct(&c,
+		v.Field(&c.Id, v.Required),
+		v.Field(&c.Mode, v.Required),
+		v.Field(&c.End, v.When(!c.Begin.IsZero() || !c.End.IsZero(), v.By(isAfter(c.Begin)))),
+		v.Field(&c.State, v.Required),
+		v.Field(&c.History, v.By(isHistoryOf(c.State))),
+		v.Field(&c.Sensors, v.Required, v.Each(v.By(func(value interface{}) error {
+			p, _ := value.(SensorProgress)
+			if !(p.Progress >= 0 && p.Progress <= 1) {
+				return ErrProgressOutOfRange
+			}
+			return nil
+		}))),
+	)
+}
+
+// Returns error if the value is not a valid cron expression.
+func isCron(value interface{}) error {
+	expr, _ := value.(string)
+	if expr == "" {
+		return nil
+	}
+	if _, err := parseCron(expr); err != nil {
+		return ErrCronInvalid.SetParams(map[string]interface{}{"reason": err.Error()})
+	}
+	return nil
+}
+
+// Returns error if the value is not a valid recurrence rule.
+func isRRule(value interface{}) error {
+	rule, _ := value.(string)
+	if rule == "" {
+		return nil
+	}
+	if _, err := parseRRule(rule, time.UTC); err != nil {
+		return ErrRRuleInvalid.SetParams(map[string]interface{}{"reason": err.Error()})
+	}
+	return nil
+}
+
+// Returns error if the value is not a known IANA time zone name.
+func isTimeZone(value interface{}) error {
+	name, _ := value.(string)
+	if _, err := time.LoadLocation(name); err != nil {
+		return ErrTimeZoneInvalid
+	}
+	return nil
+}
+
+// Validates the schedule: exactly one of Cron and RRule must be set, valid and
+// start at least one window, and the first windows must not overlap (reported on
+// the duration).
+func (s Schedule) Validate() error {
+	err := v.ValidateStruct(&s,
+		v.Field(&s.Cron, v.When(s.RRule == "", v.Required), v.When(s.RRule != "", v.Empty.Error("cannot be set along with RRule")), v.By(isCron)),
+		v.Field(&s.RRule, v.By(isRRule)),
+		v.Field(&s.Start, v.When(s.RRule != "", v.Required)),
+		v.Field(&s.Until, v.When(!s.Until.IsZero(), v.By(isAfter(s.Start)))),
+		v.Field(&s.Duration, v.Required, v.Min(1)),
+		v.Field(&s.TimeZone, v.By(isTimeZone)),
+	)
+	if err != nil {
+		return err
+	}
+	return s.checkWindows()
+}